@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
+)
+
+const (
+	redactedMAC    = "00:00:00:00:00:00"
+	redactedIPv4   = "0.0.0.0"
+	redactedIPv6   = "::"
+	redactedSerial = "REDACTED"
+)
+
+// addressPattern matches candidate IP addresses in a value, these are checked
+// before they're redacted.
+var addressPattern = regexp.MustCompile(`[0-9A-Fa-f:.]*[:.][0-9A-Fa-f:.]*`)
+
+// macPattern matches MAC addresses separated by colons or hyphens, in Cisco's
+// dotted form, or as 12 bare hex digits.
+var macPattern = regexp.MustCompile(`[0-9A-Fa-f]{2}([:-][0-9A-Fa-f]{2}){5}|[0-9A-Fa-f]{4}(\.[0-9A-Fa-f]{4}){2}|[0-9A-Fa-f]{12}`)
+
+func NewCaptureCommand(config *Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "capture",
+		Short: "Record the modem's responses, with identifying details redacted",
+		Long: `Record the modem's responses to each of the known HNAP actions, and any
+given with --action, as a GetMultipleHNAPs response. Serial numbers, MAC and IP
+addresses are redacted so the recording can be shared in bug reports.`,
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+	}
+
+	output := cmd.Flags().StringP("output", "o", "-", "file to write the recording to, - for stdout")
+	actions := cmd.Flags().StringSlice("action", nil, "additional HNAP actions to call")
+	targetName := cmd.Flags().String("target", "", "name of the configured target to record")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		err := config.Validate()
+		if err != nil {
+			return err
+		}
+
+		target := config.Target()
+		if *targetName != "" {
+			found := false
+			for _, t := range config.ResolvedTargets() {
+				if t.Name == *targetName {
+					target, found = t, true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("unknown target %q", *targetName)
+			}
+		}
+
+		gatherer, _, err := target.NewGatherer()
+		if err != nil {
+			return err
+		}
+		defer gatherer.Close()
+		err = gatherer.LoginContext(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("unable to login: %w", err)
+		}
+
+		req := map[string]string{}
+		for _, action := range hnap.KnownActions {
+			req[action] = ""
+		}
+		for _, action := range *actions {
+			req[action] = ""
+		}
+		// The responses are recorded as is, without checking the result of
+		// each action, so unsupported actions are captured too.
+		var responses map[string]interface{}
+		err = gatherer.Client().Call(cmd.Context(), hnap.GetMultipleHNAPs, req, &responses)
+		if err != nil {
+			return fmt.Errorf("unable to call actions: %w", err)
+		}
+
+		data, err := json.MarshalIndent(map[string]interface{}{
+			hnap.GetMultipleHNAPs + "Response": redact("", responses),
+		}, "", "    ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+
+		if *output == "-" {
+			_, err = io.Copy(cmd.OutOrStdout(), bytes.NewReader(data))
+			return err
+		}
+		return os.WriteFile(*output, data, 0o644)
+	}
+
+	return cmd
+}
+
+// redact replaces serial numbers, MAC and IP addresses found in the decoded
+// JSON value. The key is the name of the field holding the value.
+func redact(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			v[k] = redact(k, field)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = redact(key, elem)
+		}
+		return v
+	case string:
+		if strings.Contains(strings.ToLower(key), "serial") && v != "" {
+			return redactedSerial
+		}
+		return redactAddresses(v)
+	default:
+		return v
+	}
+}
+
+// redactAddresses replaces the MAC and IP addresses in the string.
+func redactAddresses(s string) string {
+	s = replaceStandalone(s, macPattern, func(candidate string) (string, bool) {
+		// 12 bare digits are more likely a counter than a MAC address.
+		if len(candidate) == 12 && strings.Trim(candidate, "0123456789") == "" {
+			return "", false
+		}
+		return redactedMAC, true
+	})
+	return replaceStandalone(s, addressPattern, func(candidate string) (string, bool) {
+		switch ip := net.ParseIP(candidate); {
+		case candidate == redactedMAC:
+			return "", false
+		case ip == nil:
+			return "", false
+		case ip.To4() != nil:
+			return redactedIPv4, true
+		default:
+			return redactedIPv6, true
+		}
+	})
+}
+
+// replaceStandalone replaces the pattern's matches in the string with those
+// given by replace, when it reports they should be.
+func replaceStandalone(s string, pattern *regexp.Regexp, replace func(string) (string, bool)) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringIndex(s, -1) {
+		start, end := loc[0], loc[1]
+		// Punctuation ending a sentence isn't part of the address.
+		for end > start && s[end-1] == '.' {
+			end--
+		}
+		// Addresses stand alone, parts of longer words are left as is, ie:
+		// the version in 7621-5.7.1.5.
+		if (start > 0 && isWordByte(s[start-1])) || (end < len(s) && isWordByte(s[end])) {
+			continue
+		}
+
+		replacement, ok := replace(s[start:end])
+		if !ok {
+			continue
+		}
+
+		b.WriteString(s[last:start])
+		b.WriteString(replacement)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func isWordByte(c byte) bool {
+	return c == '-' || c == '_' ||
+		('0' <= c && c <= '9') ||
+		('a' <= c && c <= 'z') ||
+		('A' <= c && c <= 'Z')
+}
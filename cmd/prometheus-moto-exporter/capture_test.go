@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap/hnaptest"
+)
+
+func TestRedactAddresses(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "00:00:5e:00:53:01", expected: redactedMAC},
+		{input: "192.0.2.10", expected: redactedIPv4},
+		{input: "2001:db8::10", expected: redactedIPv6},
+		{input: "T3 time-out;CM-MAC=00:00:5e:00:53:01;CMTS-MAC=00:00:5e:00:53:02;CM-QOS=1.1;CM-VER=3.1;", expected: "T3 time-out;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;"},
+		{input: "00-00-5E-00-53-01", expected: redactedMAC},
+		{input: "0000.5e00.5301", expected: redactedMAC},
+		{input: "00005e005301", expected: redactedMAC},
+		{input: "CM-MAC=00-00-5e-00-53-01;CMTS-MAC=0000.5e00.5302;MAC=00005e005303;", expected: "CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;MAC=00:00:00:00:00:00;"},
+		{input: "1^Locked^OFDM PLC^159^690.0^-4.2^41.0^123456789012^0^", expected: "1^Locked^OFDM PLC^159^690.0^-4.2^41.0^123456789012^0^"},
+		{input: "00005e0053010", expected: "00005e0053010"},
+		{input: "leased 192.0.2.10.", expected: "leased 0.0.0.0."},
+		{input: "7621-5.7.1.5", expected: "7621-5.7.1.5"},
+		{input: "\n 18:26:54\n Sun Nov 08 2020", expected: "\n 18:26:54\n Sun Nov 08 2020"},
+		{input: "1^Locked^QAM256^33^663.0^-9.3^38.8^42325^10482^", expected: "1^Locked^QAM256^33^663.0^-9.3^38.8^42325^10482^"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.expected, redactAddresses(tc.input))
+		})
+	}
+}
+
+func TestCaptureCommand(t *testing.T) {
+	modem := hnaptest.NewServer()
+	defer modem.Close()
+
+	config := DefaultConfig()
+	config.Endpoint = modem.Endpoint().String()
+	config.Username = hnaptest.DefaultUsername
+	config.Password = hnaptest.DefaultPassword
+
+	var out bytes.Buffer
+	cmd := NewCaptureCommand(config)
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--action", "GetMotoStatusUnknown"})
+	require.NoError(t, cmd.Execute())
+
+	var capture hnap.GetMultipleHNAPsResponse
+	require.NoError(t, json.Unmarshal(out.Bytes(), &capture))
+
+	var software hnap.MotoStatusSoftwareResponse
+	require.NoError(t, capture.Decode(hnap.GetMotoStatusSoftware, &software))
+	assert.Equal(t, redactedSerial, software.SerialNumber)
+	assert.Equal(t, redactedMAC, software.HWAddr)
+	assert.Equal(t, "8600-19.3.18", software.SoftwareVersion)
+
+	var address hnap.HomeAddressResponse
+	require.NoError(t, capture.Decode(hnap.GetHomeAddress, &address))
+	assert.Equal(t, redactedIPv4, address.IPv4.String())
+
+	// The capture can be served by the fake modem as a fixture.
+	assert.NoError(t, modem.LoadFixture(out.Bytes()))
+}
+
+func TestCaptureReplay(t *testing.T) {
+	modem := hnaptest.NewServer()
+	defer modem.Close()
+	modem.SetField(hnap.GetMotoLagStatus, hnap.GetMotoLagStatus+"Result", "ERROR")
+
+	config := DefaultConfig()
+	config.Endpoint = modem.Endpoint().String()
+	config.Username = hnaptest.DefaultUsername
+	config.Password = hnaptest.DefaultPassword
+
+	path := filepath.Join(t.TempDir(), "recording.json")
+	cmd := NewCaptureCommand(config)
+	cmd.SetArgs([]string{"--output", path})
+	require.NoError(t, cmd.Execute())
+
+	// The recording replays despite the action that failed when recorded.
+	replay, err := gather.NewReplay(path)
+	require.NoError(t, err)
+	collection, err := replay.Gather()
+	require.NoError(t, err)
+	assert.False(t, collection.Available(hnap.GetMotoLagStatus))
+	assert.Len(t, collection.Downstream, 33)
+	assert.Equal(t, redactedSerial, collection.SerialNumber)
+}
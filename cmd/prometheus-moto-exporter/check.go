@@ -2,68 +2,54 @@ package main
 
 import (
 	"fmt"
-	"net/url"
 	"os"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/expfmt"
 	"github.com/spf13/cobra"
-
-	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
 )
 
-func NewCheckCommand() *cobra.Command {
+func NewCheckCommand(config *Config) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:          "check",
 		Short:        "Run a check run against the configured endpoint",
 		SilenceUsage: true,
 	}
 
-	var (
-		endpointURL *url.URL
-	)
-
-	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
-		endpoint, err := cmd.Flags().GetString("endpoint")
-		if err != nil {
-			return err
-		}
-		parsedEndpoint, err := url.Parse(endpoint)
-		if err != nil {
-			return err
-		}
-		endpointURL = parsedEndpoint
-
-		return nil
-	}
-
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		username, err := cmd.Flags().GetString("username")
-		if err != nil {
-			return err
-		}
-		password, err := cmd.Flags().GetString("password")
-		if err != nil {
-			return err
-		}
-		gatherer, err := gather.New(endpointURL, username, password)
-		if err != nil {
-			return err
-		}
-
-		srv, err := NewServer(gatherer)
+		err := config.Validate()
 		if err != nil {
 			return err
 		}
 
 		reg := prometheus.NewRegistry()
-		err = srv.RegisterMetrics(reg)
-		if err != nil {
-			return fmt.Errorf("failed to register exporter metrics: %w", err)
-		}
-		err = srv.Collect()
-		if err != nil {
-			return fmt.Errorf("unable to get metrics from endpoint: %w", err)
+
+		if len(config.Targets) == 0 {
+			gatherer, _, err := config.NewGatherer()
+			if err != nil {
+				return err
+			}
+
+			err = collectTarget(cmd.Context(), gatherer, reg)
+			if err != nil {
+				return err
+			}
+		} else {
+			multi := newMultiServer(reg)
+			for _, target := range config.ResolvedTargets() {
+				gatherer, _, err := target.NewGatherer()
+				if err != nil {
+					return fmt.Errorf("target %q: %w", target.Name, err)
+				}
+				_, err = multi.AddTarget(target.Name, gatherer, false)
+				if err != nil {
+					return fmt.Errorf("failed to register exporter metrics: %w", err)
+				}
+			}
+			err = multi.UpdateContext(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("unable to get metrics from endpoint: %w", err)
+			}
 		}
 
 		// Gather metrics and dump to console.
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultScrapeTimeout bounds collections made for requests that don't give
+// their timeout, it's the default timeout used by Prometheus.
+const defaultScrapeTimeout = time.Second * 10
+
+// scrapeTimeoutOffset is subtracted from the scraper's timeout to leave time
+// for the response to be written.
+const scrapeTimeoutOffset = time.Millisecond * 500
+
+// collectionErrorDesc describes the error reported to the registry when
+// collecting from the device at scrape time fails.
+var collectionErrorDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "collection", "error"),
+	"error collecting from the device",
+	nil, nil,
+)
+
+// Describe implements prometheus.Collector, it's used when the Server collects
+// from the device at scrape time.
+func (s *Server) Describe(ch chan<- *prometheus.Desc) {
+	s.collectors.Describe(ch)
+	s.metaCollectors.Describe(ch)
+}
+
+// Scrape collects from the device for a scrape. Concurrent scrapes share a
+// single collection from the device, it's bounded by the scrape timeout rather
+// than by any one scrape so scrapers that give up don't fail the others.
+func (s *Server) Scrape() error {
+	_, err, shared := s.flight.Do("update", func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), s.scrapeTimeout)
+		defer cancel()
+		return nil, s.UpdateContext(ctx)
+	})
+	log := s.logger("scrape").WithField("shared", shared)
+	if err != nil {
+		log.WithError(err).Error("collection error")
+	} else {
+		log.Debug("completed successfully")
+	}
+	return err
+}
+
+// Collect implements prometheus.Collector, it's used when the Server collects
+// from the device at scrape time. The Server logs in and collects from the
+// device before reporting its metrics.
+func (s *Server) Collect(ch chan<- prometheus.Metric) {
+	err := s.Scrape()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(collectionErrorDesc, err)
+		// Don't report stale device data, only the collection's own metrics.
+		s.metaCollectors.Collect(ch)
+		return
+	}
+
+	s.collectors.Collect(ch)
+	s.metaCollectors.Collect(ch)
+}
+
+// scrapeContext bounds the request's collection by the scraper's timeout, or
+// the default when it doesn't provide one. It's used by requests that collect
+// from the device directly, ie: probes.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := defaultScrapeTimeout
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if seconds, err := strconv.ParseFloat(header, 64); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	if timeout > scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// collectorList is a prometheus.Registerer that holds onto the registered
+// collectors to be described and collected together.
+type collectorList []prometheus.Collector
+
+func (l *collectorList) Register(c prometheus.Collector) error {
+	*l = append(*l, c)
+	return nil
+}
+
+func (l *collectorList) MustRegister(cs ...prometheus.Collector) {
+	*l = append(*l, cs...)
+}
+
+func (l *collectorList) Unregister(c prometheus.Collector) bool {
+	for i, registered := range *l {
+		if registered == c {
+			*l = append((*l)[:i], (*l)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l collectorList) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range l {
+		c.Describe(ch)
+	}
+}
+
+func (l collectorList) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range l {
+		c.Collect(ch)
+	}
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
+)
+
+const (
+	envEndpoint = "MOTO_ENDPOINT"
+	envUsername = "MOTO_USERNAME"
+	envPassword = "MOTO_PASSWORD"
+	// envPasswordFile is preferred over envPassword, which is visible when
+	// inspecting containers.
+	envPasswordFile = "MOTO_PASSWORD_FILE"
+)
+
+// Config is the exporter's configuration. It's resolved from flags, the
+// environment, a configuration file and defaults - in that order of
+// precedence.
+type Config struct {
+	Endpoint string `yaml:"endpoint"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// PasswordFile is read for the password in place of Password, it's
+	// reloaded on SIGHUP.
+	PasswordFile string `yaml:"password_file"`
+
+	Bind     string        `yaml:"bind"`
+	Interval time.Duration `yaml:"interval"`
+
+	Retry   RetryConfig   `yaml:"retry"`
+	TLS     TLSConfig     `yaml:"tls"`
+	Metrics MetricsConfig `yaml:"metrics"`
+
+	// Targets configures many devices to be exported from this process, in
+	// place of the single device configured above. Target settings that are
+	// left unset use those configured above.
+	Targets []TargetConfig `yaml:"targets"`
+
+	// Probe configures the /probe endpoint, the devices it may probe are
+	// configured by Modules.
+	Probe ProbeConfig `yaml:"probe"`
+
+	// Modules configure how devices are accessed when probed, by name.
+	Modules map[string]ModuleConfig `yaml:"modules"`
+
+	// Replay is a recording, or directory of recordings, of the device's
+	// responses to export in place of the device's.
+	Replay string `yaml:"replay"`
+
+	Debug bool `yaml:"debug"`
+}
+
+// ModuleConfig configures access to probed devices. The top level settings
+// aren't used for probes, the module's credentials are only sent to the
+// devices it allows.
+type ModuleConfig struct {
+	Username     string    `yaml:"username"`
+	Password     string    `yaml:"password"`
+	PasswordFile string    `yaml:"password_file"`
+	TLS          TLSConfig `yaml:"tls"`
+
+	// Targets are the hosts, or networks in CIDR notation, of the devices
+	// the module may probe.
+	Targets []string `yaml:"targets"`
+}
+
+type ProbeConfig struct {
+	// Enabled serves the /probe endpoint.
+	Enabled bool `yaml:"enabled"`
+}
+
+// TargetConfig configures access to a single device.
+type TargetConfig struct {
+	// Name identifies the target, it's used as the target label of the
+	// target's metrics.
+	Name string `yaml:"name"`
+
+	Endpoint     string    `yaml:"endpoint"`
+	Username     string    `yaml:"username"`
+	Password     string    `yaml:"password"`
+	PasswordFile string    `yaml:"password_file"`
+	TLS          TLSConfig `yaml:"tls"`
+}
+
+type RetryConfig struct {
+	Attempts   int           `yaml:"attempts"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	Jitter     float64       `yaml:"jitter"`
+}
+
+type TLSConfig struct {
+	CAFile      string `yaml:"ca_file"`
+	Fingerprint string `yaml:"fingerprint"`
+	TOFUFile    string `yaml:"tofu_file"`
+}
+
+type MetricsConfig struct {
+	// CollectOnScrape collects from the device when scraped instead of on
+	// an interval.
+	CollectOnScrape bool `yaml:"collect_on_scrape"`
+	// ScrapeTimeout bounds the collection made for a scrape, it should be
+	// shorter than the scraper's own timeout.
+	ScrapeTimeout time.Duration `yaml:"scrape_timeout"`
+}
+
+// DefaultConfig is the configuration used for anything left unset.
+func DefaultConfig() *Config {
+	return &Config{
+		Endpoint: "https://192.168.100.1/HNAP1/",
+		Username: "admin",
+		Password: "motorola",
+
+		Bind:     "127.0.0.1:9731",
+		Interval: time.Second * 30,
+
+		Metrics: MetricsConfig{
+			ScrapeTimeout: defaultScrapeTimeout - scrapeTimeoutOffset,
+		},
+
+		Retry: RetryConfig{
+			Attempts:   DefaultRetryPolicy.Attempts,
+			Backoff:    DefaultRetryPolicy.Backoff,
+			MaxBackoff: DefaultRetryPolicy.MaxBackoff,
+			Jitter:     DefaultRetryPolicy.Jitter,
+		},
+	}
+}
+
+// LoadConfig resolves the configuration for the command.
+func LoadConfig(cmd *cobra.Command) (*Config, error) {
+	cfg := DefaultConfig()
+
+	path, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		err = cfg.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.applyEnv()
+
+	err = cfg.applyFlags(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// ReadFile reads the YAML configuration file, values set in the file replace
+// those in the Config.
+func (c *Config) ReadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config %q: %w", path, err)
+	}
+
+	return nil
+}
+
+func (c *Config) applyEnv() {
+	if v := os.Getenv(envEndpoint); v != "" {
+		c.Endpoint = v
+	}
+	if v := os.Getenv(envUsername); v != "" {
+		c.Username = v
+	}
+	if v := os.Getenv(envPassword); v != "" {
+		// The password file is preferred when both are set, don't let one
+		// set in the config file override the password given here.
+		c.Password = v
+		c.PasswordFile = ""
+	}
+	if v := os.Getenv(envPasswordFile); v != "" {
+		c.PasswordFile = v
+	}
+}
+
+// applyFlags sets the values of flags explicitly given on the command line,
+// flags that aren't defined for the command are skipped.
+func (c *Config) applyFlags(flags *pflag.FlagSet) error {
+	var err error
+	changed := func(name string) bool {
+		f := flags.Lookup(name)
+		return err == nil && f != nil && f.Changed
+	}
+
+	if changed("endpoint") {
+		c.Endpoint, err = flags.GetString("endpoint")
+	}
+	if changed("username") {
+		c.Username, err = flags.GetString("username")
+	}
+	if changed("password") {
+		c.Password, err = flags.GetString("password")
+		c.PasswordFile = ""
+	}
+	if changed("password-file") {
+		c.PasswordFile, err = flags.GetString("password-file")
+	}
+	if changed("bind") {
+		c.Bind, err = flags.GetString("bind")
+	}
+	if changed("interval") {
+		c.Interval, err = flags.GetDuration("interval")
+	}
+	if changed("probe") {
+		c.Probe.Enabled, err = flags.GetBool("probe")
+	}
+	if changed("collect-on-scrape") {
+		c.Metrics.CollectOnScrape, err = flags.GetBool("collect-on-scrape")
+	}
+	if changed("scrape-timeout") {
+		c.Metrics.ScrapeTimeout, err = flags.GetDuration("scrape-timeout")
+	}
+	if changed("retry-attempts") {
+		c.Retry.Attempts, err = flags.GetInt("retry-attempts")
+	}
+	if changed("retry-backoff") {
+		c.Retry.Backoff, err = flags.GetDuration("retry-backoff")
+	}
+	if changed("retry-max-backoff") {
+		c.Retry.MaxBackoff, err = flags.GetDuration("retry-max-backoff")
+	}
+	if changed("retry-jitter") {
+		c.Retry.Jitter, err = flags.GetFloat64("retry-jitter")
+	}
+	if changed("tls-ca-file") {
+		c.TLS.CAFile, err = flags.GetString("tls-ca-file")
+	}
+	if changed("tls-fingerprint") {
+		c.TLS.Fingerprint, err = flags.GetString("tls-fingerprint")
+	}
+	if changed("tls-tofu-file") {
+		c.TLS.TOFUFile, err = flags.GetString("tls-tofu-file")
+	}
+	if changed("replay") {
+		c.Replay, err = flags.GetString("replay")
+	}
+	if changed("debug") {
+		c.Debug, err = flags.GetBool("debug")
+	}
+
+	return err
+}
+
+// Target is the single device configured, outside of Targets.
+func (c *Config) Target() TargetConfig {
+	return TargetConfig{
+		Endpoint:     c.Endpoint,
+		Username:     c.Username,
+		Password:     c.Password,
+		PasswordFile: c.PasswordFile,
+		TLS:          c.TLS,
+	}
+}
+
+// NewGatherer prepares the gatherer for the single device configured, outside
+// of Targets. Recordings are replayed in place of the device when configured.
+func (c *Config) NewGatherer() (deviceGatherer, gather.CredentialProvider, error) {
+	if c.Replay != "" {
+		replay, err := gather.NewReplay(c.Replay)
+		if err != nil {
+			return nil, nil, err
+		}
+		return replay, nil, nil
+	}
+
+	return c.Target().NewGatherer()
+}
+
+// ResolvedTargets lists the configured Targets with their unset settings
+// filled in.
+func (c *Config) ResolvedTargets() []TargetConfig {
+	targets := make([]TargetConfig, len(c.Targets))
+	for i, target := range c.Targets {
+		targets[i] = c.resolve(target)
+	}
+	return targets
+}
+
+// errProbeNotAllowed is returned when a module doesn't allow probing a target.
+var errProbeNotAllowed = errors.New("target not allowed by module")
+
+// ProbeTarget prepares a target for probing the device at the endpoint, using
+// the settings of the named module. The module must allow the endpoint's host.
+func (c *Config) ProbeTarget(module, endpoint string) (TargetConfig, error) {
+	if module == "" {
+		return TargetConfig{}, fmt.Errorf("must be set")
+	}
+	m, ok := c.Modules[module]
+	if !ok {
+		return TargetConfig{}, fmt.Errorf("unknown module %q", module)
+	}
+
+	allowed, err := m.allows(endpoint)
+	if err != nil {
+		return TargetConfig{}, err
+	}
+	if !allowed {
+		return TargetConfig{}, fmt.Errorf("%s: %w", endpoint, errProbeNotAllowed)
+	}
+
+	return m.target(endpoint), nil
+}
+
+// target prepares a target for the device at the endpoint using only the
+// module's settings.
+func (m ModuleConfig) target(endpoint string) TargetConfig {
+	target := TargetConfig{
+		Name:         endpoint,
+		Endpoint:     endpoint,
+		Username:     m.Username,
+		Password:     m.Password,
+		PasswordFile: m.PasswordFile,
+		TLS:          m.TLS,
+	}
+	// Each device pins its own certificate, the module's devices can't share
+	// the file it's recorded to.
+	if u, err := url.Parse(endpoint); err == nil && u.Hostname() != "" && target.TLS.TOFUFile != "" {
+		target.TLS.TOFUFile += "." + fileSafeName(strings.ToLower(u.Hostname()))
+	}
+	return target
+}
+
+// allows reports whether the module may probe the device at the endpoint.
+func (m ModuleConfig) allows(endpoint string) (bool, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false, err
+	}
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+
+	for _, allowed := range m.Targets {
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true, nil
+			}
+			continue
+		}
+		if allowedIP := net.ParseIP(allowed); allowedIP != nil && ip != nil {
+			if allowedIP.Equal(ip) {
+				return true, nil
+			}
+			continue
+		}
+		if strings.EqualFold(allowed, host) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// resolve fills in the target's unset settings from the top level settings.
+func (c *Config) resolve(target TargetConfig) TargetConfig {
+	if target.Username == "" {
+		target.Username = c.Username
+	}
+	if target.Password == "" && target.PasswordFile == "" {
+		target.Password = c.Password
+		target.PasswordFile = c.PasswordFile
+	}
+	if target.TLS == (TLSConfig{}) {
+		target.TLS = c.TLS
+		// Each device pins its own certificate, targets can't share the
+		// file it's recorded to.
+		if target.TLS.TOFUFile != "" && target.Name != "" {
+			target.TLS.TOFUFile += "." + fileSafeName(target.Name)
+		}
+	}
+	return target
+}
+
+// fileSafeName replaces the characters of the name that aren't safe to use in
+// a file name.
+func fileSafeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9',
+			r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// RetryPolicy is the configured collection RetryPolicy.
+func (c *Config) RetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:   c.Retry.Attempts,
+		Backoff:    c.Retry.Backoff,
+		MaxBackoff: c.Retry.MaxBackoff,
+		Jitter:     c.Retry.Jitter,
+	}
+}
+
+// EndpointURL parses the configured endpoint.
+func (t TargetConfig) EndpointURL() (*url.URL, error) {
+	return url.Parse(t.Endpoint)
+}
+
+// CredentialProvider is the configured provider of modem credentials.
+func (t TargetConfig) CredentialProvider() (gather.CredentialProvider, error) {
+	if t.PasswordFile != "" {
+		return gather.NewPasswordFile(t.Username, t.PasswordFile)
+	}
+	return gather.StaticCredentials{
+		Username: t.Username,
+		Password: t.Password,
+	}, nil
+}
+
+// TLSOptions are the configured modem TLS verification options.
+func (t TargetConfig) TLSOptions() gather.TLSOptions {
+	return gather.TLSOptions{
+		CAFile:              t.TLS.CAFile,
+		Fingerprint:         t.TLS.Fingerprint,
+		TrustOnFirstUseFile: t.TLS.TOFUFile,
+	}
+}
+
+// NewGatherer prepares a Gatherer for the target. The credential provider is
+// returned as well so that it may be reloaded.
+func (t TargetConfig) NewGatherer() (*gather.Gatherer, gather.CredentialProvider, error) {
+	endpointURL, err := t.EndpointURL()
+	if err != nil {
+		return nil, nil, err
+	}
+	credentials, err := t.CredentialProvider()
+	if err != nil {
+		return nil, nil, err
+	}
+	gatherer, err := gather.New(endpointURL, t.Username, t.Password,
+		gather.WithTLS(t.TLSOptions()),
+		gather.WithCredentials(credentials),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gatherer, credentials, nil
+}
+
+// ConfigErrors are the problems found when validating a Config.
+type ConfigErrors []error
+
+func (errs ConfigErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the configuration for errors without contacting the device,
+// all problems found are returned as ConfigErrors.
+func (c *Config) Validate() error {
+	var errs ConfigErrors
+
+	switch {
+	case c.Replay != "":
+		// The recordings stand in for the device, it isn't accessed.
+		if len(c.Targets) != 0 {
+			errs = append(errs, fmt.Errorf("replay: cannot be used with targets"))
+		}
+		if _, err := os.Stat(c.Replay); err != nil {
+			errs = append(errs, fmt.Errorf("replay: %w", err))
+		}
+	case len(c.Targets) == 0:
+		errs = append(errs, c.Target().validate("")...)
+	}
+
+	names := map[string]bool{}
+	tofuFiles := map[string]string{}
+	for i, target := range c.ResolvedTargets() {
+		prefix := fmt.Sprintf("targets[%d].", i)
+		switch {
+		case target.Name == "":
+			errs = append(errs, fmt.Errorf("%sname: must be set", prefix))
+		case names[target.Name]:
+			errs = append(errs, fmt.Errorf("%sname: duplicate target %q", prefix, target.Name))
+		}
+		names[target.Name] = true
+
+		if file := target.TLS.TOFUFile; file != "" {
+			if other, ok := tofuFiles[file]; ok {
+				errs = append(errs, fmt.Errorf("%stls.tofu_file: %q is also used by target %q", prefix, file, other))
+			}
+			tofuFiles[file] = target.Name
+		}
+
+		errs = append(errs, target.validate(prefix)...)
+	}
+
+	if c.Probe.Enabled && len(c.Modules) == 0 {
+		errs = append(errs, fmt.Errorf("probe: no modules configured"))
+	}
+	modules := make([]string, 0, len(c.Modules))
+	for name := range c.Modules {
+		modules = append(modules, name)
+	}
+	sort.Strings(modules)
+	for _, name := range modules {
+		errs = append(errs, c.Modules[name].validate(fmt.Sprintf("modules.%s.", name))...)
+	}
+
+	if _, _, err := net.SplitHostPort(c.Bind); err != nil {
+		errs = append(errs, fmt.Errorf("bind: %w", err))
+	}
+
+	if c.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("interval: must be positive"))
+	}
+	if c.Metrics.ScrapeTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("metrics.scrape_timeout: must be positive"))
+	}
+
+	if c.Retry.Attempts < 1 {
+		errs = append(errs, fmt.Errorf("retry.attempts: must be at least 1"))
+	}
+	if c.Retry.Backoff < 0 || c.Retry.MaxBackoff < 0 {
+		errs = append(errs, fmt.Errorf("retry: backoff must not be negative"))
+	}
+	if c.Retry.Jitter < 0 || c.Retry.Jitter > 1 {
+		errs = append(errs, fmt.Errorf("retry.jitter: must be between 0 and 1"))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validate checks the target's settings, prefixing the problems found with the
+// given field path.
+func (t TargetConfig) validate(prefix string) []error {
+	var errs []error
+
+	if err := validateEndpoint(t.Endpoint); err != nil {
+		errs = append(errs, fmt.Errorf("%sendpoint: %w", prefix, err))
+	}
+
+	return append(errs, t.validateAccess(prefix)...)
+}
+
+// validate checks the module's settings, prefixing the problems found with the
+// given field path.
+func (m ModuleConfig) validate(prefix string) []error {
+	errs := m.target("").validateAccess(prefix)
+
+	if m.Password == "" && m.PasswordFile == "" {
+		errs = append(errs, fmt.Errorf("%spassword: must be set", prefix))
+	}
+
+	if len(m.Targets) == 0 {
+		errs = append(errs, fmt.Errorf("%stargets: must be set", prefix))
+	}
+	for i, target := range m.Targets {
+		if !validProbeTarget(target) {
+			errs = append(errs, fmt.Errorf("%stargets[%d]: must be a host or CIDR network", prefix, i))
+		}
+	}
+
+	return errs
+}
+
+// validProbeTarget checks that the module target is a host or CIDR network.
+func validProbeTarget(target string) bool {
+	if _, _, err := net.ParseCIDR(target); err == nil {
+		return true
+	}
+	if net.ParseIP(target) != nil {
+		return true
+	}
+	// Otherwise a host name, without a scheme or port.
+	return target != "" && !strings.ContainsAny(target, ":/")
+}
+
+// validateAccess checks the settings used to access the target's device.
+func (t TargetConfig) validateAccess(prefix string) []error {
+	var errs []error
+
+	if t.Username == "" {
+		errs = append(errs, fmt.Errorf("%susername: must be set", prefix))
+	}
+
+	if t.PasswordFile != "" {
+		if _, err := os.Stat(t.PasswordFile); err != nil {
+			errs = append(errs, fmt.Errorf("%spassword_file: %w", prefix, err))
+		}
+	}
+
+	if _, err := t.TLSOptions().Config(); err != nil {
+		errs = append(errs, fmt.Errorf("%stls: %w", prefix, err))
+	}
+
+	return errs
+}
+
+// validateEndpoint checks that the endpoint is a usable HNAP endpoint URL.
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	switch {
+	case err != nil:
+		return err
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	case u.Host == "":
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
+
+func NewConfigCommand(config *Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the exporter's configuration",
+	}
+
+	validate := &cobra.Command{
+		Use:          "validate",
+		Short:        "Validate the configuration without contacting the modem",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+	}
+	validate.RunE = func(cmd *cobra.Command, args []string) error {
+		err := config.Validate()
+		var errs ConfigErrors
+		if errors.As(err, &errs) {
+			for _, err := range errs {
+				fmt.Fprintf(cmd.ErrOrStderr(), "error: %s\n", err)
+			}
+			return fmt.Errorf("found %d configuration errors", len(errs))
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+
+		return nil
+	}
+	cmd.AddCommand(validate)
+
+	return cmd
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+endpoint: https://file/HNAP1/
+username: file-user
+password: file-password
+interval: 1m
+metrics:
+  scrape_timeout: 5s
+`), 0o600))
+
+	t.Setenv(envUsername, "env-user")
+	t.Setenv(envPassword, "env-password")
+
+	cmd := App()
+	require.NoError(t, cmd.ParseFlags([]string{
+		"--config", file,
+		"--password", "flag-password",
+	}))
+
+	config, err := LoadConfig(cmd)
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://file/HNAP1/", config.Endpoint)
+	assert.Equal(t, "env-user", config.Username)
+	assert.Equal(t, "flag-password", config.Password)
+	assert.Equal(t, time.Minute, config.Interval)
+	assert.Equal(t, 5*time.Second, config.Metrics.ScrapeTimeout)
+	assert.Equal(t, DefaultConfig().Bind, config.Bind)
+	assert.NoError(t, config.Validate())
+}
+
+func TestLoadConfigPasswordPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+password_file: /run/secrets/file-password
+`), 0o600))
+
+	load := func(args ...string) *Config {
+		cmd := App()
+		require.NoError(t, cmd.ParseFlags(append([]string{"--config", file}, args...)))
+		config, err := LoadConfig(cmd)
+		require.NoError(t, err)
+		return config
+	}
+
+	config := load()
+	assert.Equal(t, "/run/secrets/file-password", config.PasswordFile)
+
+	config = load("--password", "flag-password")
+	assert.Equal(t, "flag-password", config.Password)
+	assert.Empty(t, config.PasswordFile, "the flag overrides the file's password_file")
+
+	t.Setenv(envPassword, "env-password")
+	config = load()
+	assert.Equal(t, "env-password", config.Password)
+	assert.Empty(t, config.PasswordFile, "the environment overrides the file's password_file")
+
+	t.Setenv(envPasswordFile, "/run/secrets/env-password")
+	config = load()
+	assert.Equal(t, "/run/secrets/env-password", config.PasswordFile, "the password file is preferred at the same level")
+
+	config = load("--password", "flag-password")
+	assert.Equal(t, "flag-password", config.Password)
+	assert.Empty(t, config.PasswordFile, "the flag overrides the environment's password file")
+
+	config = load("--password-file", "/run/secrets/flag-password")
+	assert.Equal(t, "/run/secrets/flag-password", config.PasswordFile)
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := DefaultConfig()
+	config.Endpoint = "192.168.100.1"
+	config.Retry.Attempts = 0
+	config.Metrics.ScrapeTimeout = 0
+
+	err := config.Validate()
+	var errs ConfigErrors
+	require.ErrorAs(t, err, &errs)
+	assert.Len(t, errs, 3)
+}
+
+func TestConfigResolvedTargets(t *testing.T) {
+	config := DefaultConfig()
+	config.Username = "shared"
+	config.Targets = []TargetConfig{
+		{Name: "home", Endpoint: "https://192.168.100.1/HNAP1/"},
+		{Name: "office", Endpoint: "https://10.0.0.1/HNAP1/", Username: "office", Password: "secret"},
+	}
+
+	targets := config.ResolvedTargets()
+	require.Len(t, targets, 2)
+	assert.Equal(t, "shared", targets[0].Username)
+	assert.Equal(t, config.Password, targets[0].Password)
+	assert.Equal(t, "office", targets[1].Username)
+	assert.Equal(t, "secret", targets[1].Password)
+	assert.NoError(t, config.Validate())
+
+	config.Targets[1].Name = "home"
+	assert.Error(t, config.Validate())
+}
+
+func TestConfigResolvedTargetsTOFUFile(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.TLS.TOFUFile = filepath.Join(dir, "fingerprint")
+	config.Targets = []TargetConfig{
+		{Name: "home", Endpoint: "https://192.168.100.1/HNAP1/"},
+		{Name: "site/2", Endpoint: "https://10.0.0.1/HNAP1/"},
+	}
+
+	targets := config.ResolvedTargets()
+	require.Len(t, targets, 2)
+	assert.Equal(t, filepath.Join(dir, "fingerprint.home"), targets[0].TLS.TOFUFile)
+	assert.Equal(t, filepath.Join(dir, "fingerprint.site_2"), targets[1].TLS.TOFUFile)
+	assert.NoError(t, config.Validate())
+
+	config.Targets[1].TLS.TOFUFile = targets[0].TLS.TOFUFile
+	var errs ConfigErrors
+	require.ErrorAs(t, config.Validate(), &errs)
+	assert.Len(t, errs, 1, "targets can't share a tofu_file")
+}
+
+func TestConfigValidateReplay(t *testing.T) {
+	config := DefaultConfig()
+	config.Endpoint = ""
+	config.Replay = filepath.Join("testdata", "synthetic")
+	assert.NoError(t, config.Validate(), "the endpoint isn't used when replaying")
+
+	config.Targets = []TargetConfig{{Name: "home", Endpoint: "https://192.168.100.1/HNAP1/"}}
+	config.Replay = filepath.Join("testdata", "missing")
+	var errs ConfigErrors
+	require.ErrorAs(t, config.Validate(), &errs)
+	assert.Len(t, errs, 2)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// deviceCounterWrap is the range of the device's counters, these are 32-bit
+// and may be reported as signed values once they pass math.MaxInt32.
+const deviceCounterWrap = 1 << 32
+
+// deviceCounterVec exports counters maintained by the device as Prometheus
+// counters. The device's counters are reset when it reboots and wrap around at
+// 32-bits, the exported counter accounts for both to remain monotonic.
+type deviceCounterVec struct {
+	desc       *prometheus.Desc
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]*deviceCounter
+
+	// uptime is the device's last observed uptime, when known, used to tell
+	// a reboot from a wraparound.
+	uptime      time.Duration
+	uptimeKnown bool
+	// continuous is set while the device's uptime keeps increasing, only
+	// then are counters that drop taken to have wrapped around.
+	continuous bool
+}
+
+// deviceCounter is the tracked state of a single labeled counter.
+type deviceCounter struct {
+	labelValues []string
+	// last is the last raw value observed from the device.
+	last uint64
+	// total is the accumulated counter value exported.
+	total float64
+}
+
+func newDeviceCounterVec(opts prometheus.CounterOpts, labels []string) *deviceCounterVec {
+	return &deviceCounterVec{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			labels,
+			opts.ConstLabels,
+		),
+		labelNames: labels,
+		series:     map[string]*deviceCounter{},
+	}
+}
+
+// Observe records the device's current value for the counter with the given
+// labels.
+func (v *deviceCounterVec) Observe(labels prometheus.Labels, value int64) {
+	raw := uint64(value)
+	if value < 0 {
+		// Signed 32-bit representation of a value past math.MaxInt32.
+		raw = uint64(value + deviceCounterWrap)
+	}
+
+	labelValues := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		labelValues[i] = labels[name]
+	}
+	key := strings.Join(labelValues, "\x00")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.series[key]
+	if !ok {
+		v.series[key] = &deviceCounter{
+			labelValues: labelValues,
+			last:        raw,
+			total:       float64(raw),
+		}
+		return
+	}
+
+	c.total += float64(counterDelta(c.last, raw, v.continuous))
+	c.last = raw
+}
+
+// ObserveUptime records the device's uptime ahead of observing its counters.
+// The counters are reset along with the device when its uptime drops, and are
+// only taken to wrap around while its uptime increases.
+func (v *deviceCounterVec) ObserveUptime(uptime time.Duration, known bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	bothKnown := known && v.uptimeKnown
+	if bothKnown && uptime < v.uptime {
+		// Rebooted, the device counts up from zero again.
+		for _, c := range v.series {
+			c.last = 0
+		}
+	}
+	v.continuous = bothKnown && uptime >= v.uptime
+	v.uptime, v.uptimeKnown = uptime, known
+}
+
+// Delete removes the counter with the given labels, returning whether it was
+// being tracked.
+func (v *deviceCounterVec) Delete(labels prometheus.Labels) bool {
+	labelValues := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		labelValues[i] = labels[name]
+	}
+	key := strings.Join(labelValues, "\x00")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	_, ok := v.series[key]
+	delete(v.series, key)
+	return ok
+}
+
+// counterDelta determines the increase between two observed device counter
+// values. Counters that drop may only have wrapped around when the device has
+// counted continuously between the two.
+func counterDelta(last, current uint64, continuous bool) uint64 {
+	switch {
+	case current >= last:
+		return current - last
+	case continuous && last > math.MaxUint32/2 && current <= math.MaxUint32/2:
+		// A counter in the top half of its range that's now in the bottom
+		// half most likely wrapped around.
+		return deviceCounterWrap - last + current
+	default:
+		// Otherwise the device was reset (ie: rebooted) and started counting
+		// from zero again.
+		return current
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (v *deviceCounterVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+// Collect implements prometheus.Collector.
+func (v *deviceCounterVec) Collect(ch chan<- prometheus.Metric) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, c := range v.series {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.CounterValue, c.total, c.labelValues...)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterDelta(t *testing.T) {
+	testcases := []struct {
+		name       string
+		last       uint64
+		current    uint64
+		continuous bool
+		expected   uint64
+	}{
+		{name: "increase", last: 10, current: 15, expected: 5},
+		{name: "unchanged", last: 10, current: 10, expected: 0},
+		{name: "reset", last: 1000, current: 10, continuous: true, expected: 10},
+		{name: "wraparound", last: math.MaxUint32 - 4, current: 5, continuous: true, expected: 10},
+		{name: "reset from high", last: math.MaxUint32 - 4, current: 5, expected: 5},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, counterDelta(tc.last, tc.current, tc.continuous))
+		})
+	}
+}
+
+func TestDeviceCounterVecReboot(t *testing.T) {
+	v := newDeviceCounterVec(prometheus.CounterOpts{Name: "test_total"}, []string{"label"})
+	labels := prometheus.Labels{"label": "a"}
+
+	v.ObserveUptime(10*time.Hour, true)
+	v.Observe(labels, -1773898168)
+	v.ObserveUptime(10*time.Hour+30*time.Second, true)
+	v.Observe(labels, -1773898068)
+	assert.Equal(t, float64(2521069228), v.series["a"].total)
+
+	// Rebooted while the counter was high, the device counts from zero.
+	v.ObserveUptime(time.Minute, true)
+	v.Observe(labels, 50)
+	assert.Equal(t, float64(2521069278), v.series["a"].total)
+
+	// Wraps around while the device keeps counting.
+	v.ObserveUptime(2*time.Minute, true)
+	v.Observe(labels, -10)
+	v.ObserveUptime(3*time.Minute, true)
+	v.Observe(labels, 5)
+	assert.Equal(t, float64(2521069278+deviceCounterWrap-60+15), v.series["a"].total)
+
+	// Without an uptime, drops are taken as resets.
+	v.ObserveUptime(0, false)
+	v.Observe(labels, -10)
+	v.Observe(labels, 5)
+	assert.Equal(t, float64(2521069278+deviceCounterWrap-60+15+deviceCounterWrap-15+5), v.series["a"].total)
+}
+
+func TestDeviceCounterVecSigned(t *testing.T) {
+	v := newDeviceCounterVec(prometheus.CounterOpts{Name: "test_total"}, []string{"label"})
+	labels := prometheus.Labels{"label": "a"}
+
+	// Taken from the sample OFDM row, a counter past math.MaxInt32.
+	v.ObserveUptime(time.Hour, true)
+	v.Observe(labels, -1773898168)
+	assert.Equal(t, float64(2521069128), v.series["a"].total)
+
+	// Continues counting once it crosses back into the positive range.
+	v.ObserveUptime(2*time.Hour, true)
+	v.Observe(labels, 100)
+	assert.Equal(t, float64(deviceCounterWrap+100), v.series["a"].total)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap/hnaptest"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden exposition files in testdata/golden")
+
+// goldenVolatile are metrics that depend on the time of collection, they're
+// left out of the golden exposition.
+var goldenVolatile = map[string]bool{
+	"moto_collection_seconds":                           true,
+	"moto_last_successful_collection_timestamp_seconds": true,
+	"moto_device_boot_time_seconds":                     true,
+}
+
+// TestGoldenExposition collects from each of the fixtures and compares the
+// exported metrics to those expected in testdata/golden. Run with -update to
+// accept changes.
+//
+// The fixtures are the MB8600 response the fake modem answers with and the
+// hand-written responses in testdata/synthetic, see testdata/README.md.
+func TestGoldenExposition(t *testing.T) {
+	fixtures := map[string][]byte{
+		"mb8600-19.3.18": hnaptest.DefaultFixture,
+	}
+	paths, err := filepath.Glob(filepath.Join("testdata", "synthetic", "*.json"))
+	require.NoError(t, err)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		fixtures[strings.TrimSuffix(filepath.Base(path), ".json")] = data
+	}
+
+	for name, fixture := range fixtures {
+		name, fixture := name, fixture
+		t.Run(name, func(t *testing.T) {
+			actual := goldenExposition(t, fixture)
+
+			golden := filepath.Join("testdata", "golden", name+".prom")
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(golden, actual, 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+// goldenExposition collects from a device answering with the fixture and
+// renders the registry's metrics as text.
+func goldenExposition(t *testing.T, fixture []byte) []byte {
+	modem := hnaptest.NewServer()
+	t.Cleanup(modem.Close)
+	require.NoError(t, modem.LoadFixture(fixture))
+
+	gatherer, err := gather.New(modem.Endpoint(), hnaptest.DefaultUsername, hnaptest.DefaultPassword)
+	require.NoError(t, err)
+	srv, err := newServer(gatherer, false)
+	require.NoError(t, err)
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, srv.RegisterMetrics(reg))
+	require.NoError(t, srv.UpdateContext(context.Background()))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if goldenVolatile[mf.GetName()] {
+			continue
+		}
+		_, err := expfmt.MetricFamilyToText(&buf, mf)
+		require.NoError(t, err)
+	}
+	return buf.Bytes()
+}
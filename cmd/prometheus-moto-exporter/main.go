@@ -1,22 +1,15 @@
 package main
 
 import (
-	"net/url"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
-
-	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
-)
-
-// TODO: read these in! Maybe use viper?
-const (
-	envEndpoint = "MOTO_ENDPOINT"
-	envUsername = "MOTO_USERNAME"
-	envPassword = "MOTO_PASSWORD"
 )
 
 func main() {
@@ -26,14 +19,8 @@ func main() {
 }
 
 func App() *cobra.Command {
-
-	var (
-		logDebug bool
-		bindAddr string
-		endpoint string
-		username string
-		password string
-	)
+	// config is resolved before any command is run.
+	config := DefaultConfig()
 
 	cmd := &cobra.Command{
 		Use:   "prometheus-moto-exporter",
@@ -43,60 +30,132 @@ func App() *cobra.Command {
 		// Don't print usage on run errors.
 		SilenceUsage: true,
 	}
-	cmd.AddCommand(NewCheckCommand())
+	cmd.AddCommand(NewCheckCommand(config))
+	cmd.AddCommand(NewCaptureCommand(config))
+	cmd.AddCommand(NewConfigCommand(config))
 
-	cmd.Flags().StringVar(&bindAddr, "bind", "127.0.0.1:9731", "http server bind address")
+	// Flags are applied over the environment and config file when given,
+	// their defaults are only shown for reference.
+	defaults := DefaultConfig()
 
-	cmd.PersistentFlags().StringVar(&endpoint, "endpoint", "https://192.168.100.1/HNAP1/", "modem HNAP endpoint")
-	cmd.PersistentFlags().StringVar(&username, "username", "admin", "modem HNAP username")
-	cmd.PersistentFlags().StringVar(&password, "password", "motorola", "modem HNAP password")
+	cmd.Flags().String("bind", defaults.Bind, "http server bind address")
+	cmd.Flags().Duration("interval", defaults.Interval, "interval to collect from the modem on")
+	cmd.Flags().Bool("probe", defaults.Probe.Enabled, "serve /probe for the modems allowed by the configured modules")
+	cmd.Flags().Bool("collect-on-scrape", defaults.Metrics.CollectOnScrape, "collect from the modem when scraped instead of on an interval")
+	cmd.Flags().Duration("scrape-timeout", defaults.Metrics.ScrapeTimeout, "time allowed to collect from the modem when scraped")
+	cmd.Flags().Int("retry-attempts", defaults.Retry.Attempts, "collection attempts made before giving up on transient errors")
+	cmd.Flags().Duration("retry-backoff", defaults.Retry.Backoff, "delay before retrying a failed collection, doubled on each retry")
+	cmd.Flags().Duration("retry-max-backoff", defaults.Retry.MaxBackoff, "maximum delay between collection retries, 0 for no maximum")
+	cmd.Flags().Float64("retry-jitter", defaults.Retry.Jitter, "fraction of the retry delay to randomly vary by")
 
-	cmd.PersistentFlags().BoolVar(&logDebug, "debug", false, "enable debug logging")
+	cmd.PersistentFlags().String("config", "", "YAML configuration file")
 
-	var (
-		endpointURL *url.URL
-	)
+	cmd.PersistentFlags().String("endpoint", defaults.Endpoint, "modem HNAP endpoint")
+	cmd.PersistentFlags().String("username", defaults.Username, "modem HNAP username")
+	cmd.PersistentFlags().String("password", defaults.Password, "modem HNAP password")
+	cmd.PersistentFlags().String("password-file", defaults.PasswordFile, "file to read the modem HNAP password from, reloaded on SIGHUP")
 
-	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
-		logrus.SetLevel(logrus.InfoLevel)
-		if logDebug {
-			logrus.SetLevel(logrus.DebugLevel)
-		}
+	cmd.PersistentFlags().String("tls-ca-file", defaults.TLS.CAFile, "PEM bundle the modem's certificate must chain to")
+	cmd.PersistentFlags().String("tls-fingerprint", defaults.TLS.Fingerprint, "SHA-256 fingerprint to pin the modem's certificate to")
+	cmd.PersistentFlags().String("tls-tofu-file", defaults.TLS.TOFUFile, "file to record and pin the modem's certificate fingerprint to on first use")
 
-		if v := os.Getenv(envEndpoint); v != "" && !cmd.Flag("endpoint").Changed {
-			endpoint = os.Getenv(envEndpoint)
-		}
-		if v := os.Getenv(envUsername); v != "" && !cmd.Flag("username").Changed {
-			username = os.Getenv(envUsername)
-		}
-		if v := os.Getenv(envPassword); v != "" && !cmd.Flag("password").Changed {
-			password = os.Getenv(envPassword)
-		}
+	cmd.PersistentFlags().String("replay", defaults.Replay, "recorded responses, or a directory of them, to export in place of the modem's")
 
-		parsedEndpoint, err := url.Parse(endpoint)
+	cmd.PersistentFlags().Bool("debug", defaults.Debug, "enable debug logging")
+
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		loaded, err := LoadConfig(cmd)
 		if err != nil {
 			return err
 		}
-		endpointURL = parsedEndpoint
+		*config = *loaded
+
+		logrus.SetLevel(logrus.InfoLevel)
+		if config.Debug {
+			logrus.SetLevel(logrus.DebugLevel)
+		}
 
 		return nil
 	}
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		logrus.WithFields(logrus.Fields{
-			"endpoint": endpointURL,
-			"username": username,
-		}).Debugf("configured for HNAP metrics")
-
-		gatherer, err := gather.New(endpointURL, username, password)
+		err := config.Validate()
 		if err != nil {
 			return err
 		}
 
-		server, err := NewServer(gatherer)
-		if err != nil {
-			logrus.WithError(err).Error("unable to setup server")
-			return err
+		// server is either a single or multiple target server.
+		var server interface {
+			Handle(pattern string, handler http.Handler)
+			Run(ctx context.Context, addr string) error
+		}
+		var reloaders []credentialReloader
+
+		if len(config.Targets) == 0 {
+			if config.Replay != "" {
+				logrus.WithField("replay", config.Replay).Info("replaying recorded responses")
+			} else {
+				logrus.WithFields(logrus.Fields{
+					"endpoint": config.Endpoint,
+					"username": config.Username,
+				}).Debugf("configured for HNAP metrics")
+			}
+
+			gatherer, credentials, err := config.NewGatherer()
+			if err != nil {
+				return err
+			}
+			if reloader, ok := credentials.(credentialReloader); ok {
+				reloaders = append(reloaders, reloader)
+			}
+
+			newServer := NewServer
+			if config.Metrics.CollectOnScrape {
+				newServer = NewScrapeServer
+			}
+			single, err := newServer(gatherer)
+			if err != nil {
+				logrus.WithError(err).Error("unable to setup server")
+				return err
+			}
+			single.SetInterval(config.Interval)
+			single.SetScrapeTimeout(config.Metrics.ScrapeTimeout)
+			single.SetRetryPolicy(config.RetryPolicy())
+			server = single
+		} else {
+			multi, err := NewMultiServer()
+			if err != nil {
+				return err
+			}
+			for _, target := range config.ResolvedTargets() {
+				logrus.WithFields(logrus.Fields{
+					"target":   target.Name,
+					"endpoint": target.Endpoint,
+					"username": target.Username,
+				}).Debugf("configured for HNAP metrics")
+
+				gatherer, credentials, err := target.NewGatherer()
+				if err != nil {
+					return fmt.Errorf("target %q: %w", target.Name, err)
+				}
+				if reloader, ok := credentials.(credentialReloader); ok {
+					reloaders = append(reloaders, reloader)
+				}
+
+				targetServer, err := multi.AddTarget(target.Name, gatherer, config.Metrics.CollectOnScrape)
+				if err != nil {
+					logrus.WithError(err).Error("unable to setup server")
+					return err
+				}
+				targetServer.SetInterval(config.Interval)
+				targetServer.SetScrapeTimeout(config.Metrics.ScrapeTimeout)
+				targetServer.SetRetryPolicy(config.RetryPolicy())
+			}
+			server = multi
+		}
+
+		if config.Probe.Enabled {
+			server.Handle("/probe", NewProbeHandler(config))
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -110,7 +169,30 @@ func App() *cobra.Command {
 			cancel()
 		}()
 
-		err = server.Run(ctx, bindAddr)
+		if len(reloaders) > 0 {
+			sighup := make(chan os.Signal, 1)
+			signal.Notify(sighup, syscall.SIGHUP)
+			defer signal.Stop(sighup)
+
+			go func() {
+				for {
+					select {
+					case <-sighup:
+						logrus.Info("SIGHUP: reloading credentials")
+						for _, reloader := range reloaders {
+							err := reloader.Reload()
+							if err != nil {
+								logrus.WithError(err).Error("unable to reload credentials")
+							}
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		err = server.Run(ctx, config.Bind)
 		if err != nil {
 			logrus.WithError(err).Error("server error")
 			return err
@@ -123,3 +205,9 @@ func App() *cobra.Command {
 
 	return cmd
 }
+
+// credentialReloader is implemented by credential providers that are able to
+// reload their credentials, ie: on SIGHUP.
+type credentialReloader interface {
+	Reload() error
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const labelTarget = "target"
+
+// MultiServer exports metrics for many devices from a single process. Each
+// target has its own Server, and its metrics are labeled with the target's
+// name.
+type MultiServer struct {
+	registry serverRegistry
+	servers  []*Server
+
+	// handlers are served alongside the metrics.
+	handlers map[string]http.Handler
+}
+
+// NewMultiServer prepares a MultiServer that exports its targets' metrics
+// using the default registry.
+func NewMultiServer() (*MultiServer, error) {
+	reg, ok := prometheus.DefaultRegisterer.(serverRegistry)
+	if !ok {
+		return nil, fmt.Errorf("unable to use default registry")
+	}
+
+	return newMultiServer(reg), nil
+}
+
+func newMultiServer(reg serverRegistry) *MultiServer {
+	return &MultiServer{
+		registry: reg,
+	}
+}
+
+// AddTarget prepares a Server for the named target's device and adds its
+// metrics to the MultiServer's registry.
+func (m *MultiServer) AddTarget(name string, gatherer deviceGatherer, scrape bool) (*Server, error) {
+	for _, s := range m.servers {
+		if s.target == name {
+			return nil, fmt.Errorf("duplicate target %q", name)
+		}
+	}
+
+	s, err := newServer(gatherer, scrape)
+	if err != nil {
+		return nil, err
+	}
+	s.target = name
+
+	reg := prometheus.WrapRegistererWith(prometheus.Labels{
+		labelTarget: name,
+	}, m.registry)
+	err = s.registerCollectors(reg)
+	if err != nil {
+		return nil, fmt.Errorf("target %q: %w", name, err)
+	}
+
+	m.servers = append(m.servers, s)
+
+	return s, nil
+}
+
+// UpdateContext collects from each of the targets' devices once.
+func (m *MultiServer) UpdateContext(ctx context.Context) error {
+	for _, s := range m.servers {
+		err := s.UpdateContext(ctx)
+		if err != nil {
+			return fmt.Errorf("target %q: %w", s.target, err)
+		}
+	}
+	return nil
+}
+
+// Run serves the targets' metrics and collects from each of their devices
+// until the context is cancelled.
+func (m *MultiServer) Run(ctx context.Context, addr string) error {
+	var loops []func(context.Context) error
+	for _, s := range m.servers {
+		if s.scrape {
+			s.logger("server").Info("collecting from device on scrape")
+			continue
+		}
+		loops = append(loops, s.collectLoop)
+	}
+
+	return serve(ctx, addr, m.registry, m.handlers, loops)
+}
+
+// Handle adds a handler to be served alongside the metrics.
+func (m *MultiServer) Handle(pattern string, handler http.Handler) {
+	if m.handlers == nil {
+		m.handlers = map[string]http.Handler{}
+	}
+	m.handlers[pattern] = handler
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
+)
+
+func TestMultiServerTargetLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	multi := newMultiServer(reg)
+
+	for _, name := range []string{"home", "office"} {
+		gatherer, err := gather.New(&url.URL{Scheme: "https", Host: name}, "admin", "motorola")
+		require.NoError(t, err)
+		_, err = multi.AddTarget(name, gatherer, false)
+		require.NoError(t, err)
+	}
+
+	_, err := multi.AddTarget("home", nil, false)
+	assert.Error(t, err, "duplicate targets are rejected")
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	var targets []string
+	for _, mf := range mfs {
+		if mf.GetName() != "moto_up" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == labelTarget {
+					targets = append(targets, label.GetValue())
+				}
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"home", "office"}, targets)
+}
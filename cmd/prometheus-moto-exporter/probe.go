@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+// probeEndpointPath is the HNAP endpoint path used for probe targets that are
+// only a host.
+const probeEndpointPath = "/HNAP1/"
+
+// ProbeHandler probes devices named in requests, in the manner of the
+// blackbox exporter: each request logs in to the target's device, collects
+// from it once and responds with its metrics. The named module must allow
+// the target.
+//
+//	/probe?target=https://192.168.100.1/HNAP1/&module=mb8600
+type ProbeHandler struct {
+	config *Config
+}
+
+// NewProbeHandler prepares a ProbeHandler that accesses devices using the
+// configuration's modules.
+func NewProbeHandler(config *Config) *ProbeHandler {
+	return &ProbeHandler{
+		config: config,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	endpoint, err := probeEndpoint(params.Get("target"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("target: %v", err), http.StatusBadRequest)
+		return
+	}
+	module := params.Get("module")
+	target, err := h.config.ProbeTarget(module, endpoint)
+	if errors.Is(err, errProbeNotAllowed) {
+		http.Error(w, fmt.Sprintf("target: %v", err), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("module: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"context": "probe",
+		"target":  endpoint,
+		"module":  module,
+	})
+
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+
+	gatherer, _, err := target.NewGatherer()
+	if err != nil {
+		log.WithError(err).Error("unable to setup probe")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Connections to probed devices aren't reused, don't leave them open.
+	defer gatherer.Close()
+
+	reg := prometheus.NewRegistry()
+	err = collectTarget(ctx, gatherer, reg)
+	if err != nil {
+		// The failure is reported by the collected metrics, ie: moto_up.
+		log.WithError(err).Error("probe failed")
+	}
+
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		ErrorLog:      log.WithField("handler", "prometheus"),
+		ErrorHandling: promhttp.ContinueOnError,
+	}).ServeHTTP(w, r)
+}
+
+// probeEndpoint determines the HNAP endpoint of a probe target, the target may
+// be the endpoint's URL or only its host.
+func probeEndpoint(target string) (string, error) {
+	if target == "" {
+		return "", fmt.Errorf("must be set")
+	}
+
+	if !strings.Contains(target, "://") {
+		target = (&url.URL{
+			Scheme: "https",
+			Host:   target,
+			Path:   probeEndpointPath,
+		}).String()
+	}
+
+	if err := validateEndpoint(target); err != nil {
+		return "", err
+	}
+
+	return target, nil
+}
+
+// collectTarget logs in to the device and collects from it once, registering
+// the metrics with the registry.
+func collectTarget(ctx context.Context, gatherer deviceGatherer, reg serverRegistry) error {
+	srv, err := newServer(gatherer, false)
+	if err != nil {
+		return err
+	}
+
+	err = srv.RegisterMetrics(reg)
+	if err != nil {
+		return fmt.Errorf("failed to register exporter metrics: %w", err)
+	}
+
+	err = srv.UpdateContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get metrics from endpoint: %w", err)
+	}
+
+	return nil
+}
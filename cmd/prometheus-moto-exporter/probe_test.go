@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap/hnaptest"
+)
+
+func TestProbeEndpoint(t *testing.T) {
+	testcases := []struct {
+		target   string
+		expected string
+		err      bool
+	}{
+		{target: "192.168.100.1", expected: "https://192.168.100.1/HNAP1/"},
+		{target: "10.0.0.1:8443", expected: "https://10.0.0.1:8443/HNAP1/"},
+		{target: "http://10.0.0.1/HNAP1/", expected: "http://10.0.0.1/HNAP1/"},
+		{target: "", err: true},
+		{target: "ftp://10.0.0.1/", err: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.target, func(t *testing.T) {
+			endpoint, err := probeEndpoint(tc.target)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, endpoint)
+		})
+	}
+}
+
+func TestConfigProbeTarget(t *testing.T) {
+	config := DefaultConfig()
+	config.Username = "admin"
+	config.Password = "shared"
+	config.TLS.TOFUFile = "fingerprint"
+	config.Modules = map[string]ModuleConfig{
+		"mb8600": {Username: "admin", Password: "secret", Targets: []string{"10.0.0.0/24", "modem.example.com"}},
+	}
+	require.NoError(t, config.Validate())
+
+	target, err := config.ProbeTarget("mb8600", "https://10.0.0.1/HNAP1/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.1/HNAP1/", target.Endpoint)
+	assert.Equal(t, "admin", target.Username)
+	assert.Equal(t, "secret", target.Password)
+	assert.Empty(t, target.TLS.TOFUFile, "top level settings aren't used for probes")
+
+	_, err = config.ProbeTarget("mb8600", "https://MODEM.example.com:8443/HNAP1/")
+	assert.NoError(t, err)
+
+	_, err = config.ProbeTarget("mb8600", "https://10.0.1.1/HNAP1/")
+	assert.ErrorIs(t, err, errProbeNotAllowed)
+
+	_, err = config.ProbeTarget("", "https://10.0.0.1/HNAP1/")
+	assert.Error(t, err, "a module must be named")
+
+	_, err = config.ProbeTarget("unknown", "https://10.0.0.1/HNAP1/")
+	assert.Error(t, err)
+}
+
+func TestConfigProbeTargetTOFUFile(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.Modules = map[string]ModuleConfig{
+		"mb8600": {
+			Username: "admin",
+			Password: "secret",
+			TLS:      TLSConfig{TOFUFile: filepath.Join(dir, "fingerprint")},
+			Targets:  []string{"10.0.0.0/24", "modem.example.com"},
+		},
+	}
+	require.NoError(t, config.Validate())
+
+	// Each probed device records its certificate to its own file.
+	for endpoint, expected := range map[string]string{
+		"https://10.0.0.1/HNAP1/":               "fingerprint.10.0.0.1",
+		"https://10.0.0.2/HNAP1/":               "fingerprint.10.0.0.2",
+		"https://MODEM.example.com:8443/HNAP1/": "fingerprint.modem.example.com",
+	} {
+		target, err := config.ProbeTarget("mb8600", endpoint)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, expected), target.TLS.TOFUFile, endpoint)
+	}
+}
+
+func TestConfigValidateModules(t *testing.T) {
+	config := DefaultConfig()
+	config.Probe.Enabled = true
+	var errs ConfigErrors
+	require.ErrorAs(t, config.Validate(), &errs)
+	assert.Len(t, errs, 1, "probing needs modules")
+
+	config.Modules = map[string]ModuleConfig{
+		"mb8600": {Targets: []string{"https://10.0.0.1/"}},
+	}
+	require.ErrorAs(t, config.Validate(), &errs)
+	assert.Len(t, errs, 3, "username, password and targets are checked")
+}
+
+func TestProbeHandlerBadRequest(t *testing.T) {
+	config := DefaultConfig()
+	config.Modules = map[string]ModuleConfig{
+		"mb8600": {Username: "admin", Password: "secret", Targets: []string{"192.168.100.1"}},
+	}
+	handler := NewProbeHandler(config)
+
+	for query, code := range map[string]int{
+		"":                                       http.StatusBadRequest,
+		"?target=10.0.0.1":                       http.StatusBadRequest,
+		"?target=10.0.0.1&module=unknown":        http.StatusBadRequest,
+		"?target=10.0.0.1&module=mb8600":         http.StatusForbidden,
+		"?target=attacker.example&module=mb8600": http.StatusForbidden,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/probe"+query, nil))
+		assert.Equal(t, code, rec.Code, query)
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	modem := hnaptest.NewServer()
+	defer modem.Close()
+
+	config := DefaultConfig()
+	config.Modules = map[string]ModuleConfig{
+		"mb8600": {Username: hnaptest.DefaultUsername, Password: hnaptest.DefaultPassword, Targets: []string{"127.0.0.1"}},
+	}
+	handler := NewProbeHandler(config)
+
+	query := url.Values{"target": {modem.Endpoint().String()}, "module": {"mb8600"}}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/probe?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, strings.Split(rec.Body.String(), "\n"), "moto_up 1")
+}
+
+func TestProbeHandlerTOFUFile(t *testing.T) {
+	modem := hnaptest.NewServer()
+	defer modem.Close()
+
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.Modules = map[string]ModuleConfig{
+		"mb8600": {
+			Username: hnaptest.DefaultUsername,
+			Password: hnaptest.DefaultPassword,
+			TLS:      TLSConfig{TOFUFile: filepath.Join(dir, "fingerprint")},
+			Targets:  []string{"127.0.0.1"},
+		},
+	}
+	handler := NewProbeHandler(config)
+
+	probe := func() int {
+		query := url.Values{"target": {modem.Endpoint().String()}, "module": {"mb8600"}}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/probe?"+query.Encode(), nil))
+		return rec.Code
+	}
+
+	// The certificate is recorded on the first probe and pinned after.
+	assert.Equal(t, http.StatusOK, probe())
+	assert.FileExists(t, filepath.Join(dir, "fingerprint.127.0.0.1"))
+	assert.NoFileExists(t, filepath.Join(dir, "fingerprint"))
+	assert.Equal(t, http.StatusOK, probe())
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
+)
+
+// RetryPolicy configures how failed collections are retried.
+type RetryPolicy struct {
+	// Attempts is the total number of attempts made, including the first.
+	Attempts int
+	// Backoff is the delay before the first retry, it's doubled for each
+	// subsequent retry.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries, the delay is uncapped when
+	// it's 0.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the delay that's randomly added or removed,
+	// ie: 0.2 for +/- 20%.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used unless otherwise configured.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	Backoff:    time.Second,
+	MaxBackoff: time.Second * 10,
+	Jitter:     0.2,
+}
+
+// Delay determines the wait before making the given retry, starting from 1.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || delay < p.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		spread := float64(delay) * p.Jitter
+		delay += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+
+	return delay
+}
+
+// Do calls fn until it succeeds, the policy's attempts are exhausted, or it
+// returns an error that isn't transient. The retry callback is called before
+// each retry is made.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error, retry func(attempt int, err error)) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !isTransient(err) || attempt >= p.Attempts {
+			return err
+		}
+
+		delay := p.Delay(attempt)
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"context": "retry",
+			"attempt": attempt,
+			"delay":   delay,
+		}).Warn("transient error, retrying")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		if retry != nil {
+			retry(attempt, err)
+		}
+	}
+}
+
+// isTransient reports whether the error is likely to clear up on its own, ie:
+// network trouble, as opposed to failures that need intervention like rejected
+// credentials or certificates.
+func isTransient(err error) bool {
+	if errors.Is(err, gather.ErrLoginRejected) || errors.Is(err, gather.ErrFingerprintMismatch) {
+		return false
+	}
+
+	// The device's certificate fails verification the same way until it or
+	// the configuration changes.
+	var (
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+
+	// The device responded, retrying won't change its response.
+	var parseErr *gather.ParseError
+	if errors.As(err, &parseErr) {
+		return false
+	}
+
+	var statusErr *gather.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+
+	// Every error from the HTTP client is a url.Error, only its cause tells
+	// network trouble apart.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		Backoff:    time.Second,
+		MaxBackoff: time.Second * 5,
+	}
+
+	assert.Equal(t, time.Second, policy.Delay(1))
+	assert.Equal(t, time.Second*2, policy.Delay(2))
+	assert.Equal(t, time.Second*4, policy.Delay(3))
+	assert.Equal(t, time.Second*5, policy.Delay(4))
+
+	uncapped := RetryPolicy{Backoff: time.Second}
+	assert.Equal(t, time.Second*8, uncapped.Delay(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(1)
+		assert.GreaterOrEqual(t, delay, time.Second/2)
+		assert.LessOrEqual(t, delay, time.Second*3/2)
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3}
+
+	t.Run("transient", func(t *testing.T) {
+		var calls, retries int
+		err := policy.Do(context.Background(), func() error {
+			calls++
+			return io.ErrUnexpectedEOF
+		}, func(int, error) { retries++ })
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, 2, retries)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		var calls int
+		err := policy.Do(context.Background(), func() error {
+			calls++
+			return gather.ErrLoginRejected
+		}, nil)
+		assert.ErrorIs(t, err, gather.ErrLoginRejected)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("recovers", func(t *testing.T) {
+		var calls int
+		err := policy.Do(context.Background(), func() error {
+			calls++
+			if calls < 2 {
+				return &gather.StatusError{StatusCode: 503, Status: "503 Service Unavailable"}
+			}
+			return nil
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.False(t, isTransient(errors.New("unknown")))
+	assert.False(t, isTransient(&gather.StatusError{StatusCode: 404}))
+	assert.False(t, isTransient(&gather.ParseError{Err: io.ErrUnexpectedEOF}))
+	assert.True(t, isTransient(&gather.StatusError{StatusCode: 502}))
+
+	// Errors from the HTTP client are all url.Errors, only network trouble is
+	// retried.
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://192.168.100.1/HNAP1/", Err: err}
+	}
+	assert.False(t, isTransient(urlErr(fmt.Errorf("%w: expected 00 but device presented 01", gather.ErrFingerprintMismatch))))
+	assert.False(t, isTransient(urlErr(x509.UnknownAuthorityError{})))
+	assert.False(t, isTransient(urlErr(x509.HostnameError{Host: "192.168.100.1", Certificate: &x509.Certificate{}})))
+	assert.False(t, isTransient(urlErr(errors.New("unknown"))))
+	assert.True(t, isTransient(urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)})))
+	assert.True(t, isTransient(urlErr(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)})))
+	assert.True(t, isTransient(urlErr(io.EOF)))
+	assert.True(t, isTransient(urlErr(context.DeadlineExceeded)))
+}
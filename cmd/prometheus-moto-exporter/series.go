@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesSet tracks the label sets recorded during a collection so that series
+// no longer reported by the device can be removed.
+type seriesSet struct {
+	previous map[string]prometheus.Labels
+	current  map[string]prometheus.Labels
+}
+
+// Add records the label set as present in the current collection.
+func (s *seriesSet) Add(labels prometheus.Labels) {
+	if s.current == nil {
+		s.current = map[string]prometheus.Labels{}
+	}
+	s.current[labelsKey(labels)] = labels
+}
+
+// Sweep completes the current collection and returns the label sets that were
+// present in the previous collection but not in the current one.
+func (s *seriesSet) Sweep() []prometheus.Labels {
+	var stale []prometheus.Labels
+	for key, labels := range s.previous {
+		if _, ok := s.current[key]; !ok {
+			stale = append(stale, labels)
+		}
+	}
+
+	s.previous = s.current
+	s.current = nil
+
+	return stale
+}
+
+// labelsKey is a stable identity for a label set.
+func labelsKey(labels prometheus.Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		sb.WriteString(labels[name])
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesSetSweep(t *testing.T) {
+	var set seriesSet
+
+	a := prometheus.Labels{labelChannel: "1", labelModulation: "QAM256"}
+	b := prometheus.Labels{labelChannel: "2", labelModulation: "QAM256"}
+	rebonded := prometheus.Labels{labelChannel: "2", labelModulation: "OFDM PLC"}
+
+	set.Add(a)
+	set.Add(b)
+	assert.Empty(t, set.Sweep(), "nothing recorded before the first collection")
+
+	set.Add(a)
+	set.Add(rebonded)
+	assert.Equal(t, []prometheus.Labels{b}, set.Sweep())
+
+	assert.ElementsMatch(t, []prometheus.Labels{a, rebonded}, set.Sweep())
+}
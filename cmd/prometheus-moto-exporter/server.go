@@ -4,13 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
 	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
@@ -26,53 +29,136 @@ const (
 	labelCustomerVersion = "customer_version"
 	labelSpecVersion     = "spec_version"
 	labelBootFile        = "boot_file"
+	labelPriority        = "priority"
+	labelEvent           = "event"
+	labelStep            = "step"
+	labelComment         = "comment"
+	labelHWAddr          = "hwaddr"
+	labelIPv4            = "ipv4"
+	labelIPv6            = "ipv6"
+	labelStage           = "stage"
+	labelTable           = "table"
+	labelAction          = "action"
 
 	namespace = "moto"
 )
 
+// Collection stages reported on failure.
+const (
+	stageLogin  = "login"
+	stageGather = "gather"
+	stageParse  = "parse"
+)
+
 type serverRegistry interface {
 	prometheus.Gatherer
 	prometheus.Registerer
 }
 
 type Server struct {
-	gatherer *gather.Gatherer
+	gatherer deviceGatherer
 
 	upstream   *upstreamMetrics
 	downstream *downstreamMetrics
 	device     *deviceMetrics
+	log        *logMetrics
+	startup    *startupMetrics
 
 	meta *metaMetrics
 
 	registry serverRegistry
+
+	// target names the device when the Server is one of many.
+	target string
+
+	interval time.Duration
+	retry    RetryPolicy
+
+	// scrape configures the Server to collect from the device when scraped,
+	// the Server is registered as a collector in place of its metrics.
+	scrape         bool
+	scrapeTimeout  time.Duration
+	flight         singleflight.Group
+	collectors     collectorList
+	metaCollectors collectorList
+
+	// handlers are served alongside the metrics.
+	handlers map[string]http.Handler
+}
+
+// deviceGatherer gathers Collections from a device, ie: a gather.Gatherer or a
+// gather.Replay of recordings.
+type deviceGatherer interface {
+	LoggedIn() bool
+	LoginContext(ctx context.Context) error
+	GatherContext(ctx context.Context) (*gather.Collection, error)
+}
+
+// NewServer prepares a Server that collects from the device on an interval.
+func NewServer(gatherer deviceGatherer) (*Server, error) {
+	s, err := newServer(gatherer, false)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.registerDefault()
+}
+
+// NewScrapeServer prepares a Server that collects from the device each time
+// its metrics are scraped.
+func NewScrapeServer(gatherer deviceGatherer) (*Server, error) {
+	s, err := newServer(gatherer, true)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.registerDefault()
 }
 
-func NewServer(gatherer *gather.Gatherer) (*Server, error) {
+func newServer(gatherer deviceGatherer, scrape bool) (*Server, error) {
 	s := &Server{
 		gatherer: gatherer,
+		scrape:   scrape,
+		interval: time.Second * 30,
+
+		scrapeTimeout: defaultScrapeTimeout - scrapeTimeoutOffset,
+		retry:         DefaultRetryPolicy,
 
 		upstream:   NewUpstreamMetrics(),
 		downstream: NewDownstreamMetrics(),
 		device:     NewDeviceMetrics(),
+		log:        NewLogMetrics(),
+		startup:    NewStartupMetrics(),
 		meta:       NewMetaMetrics(),
 	}
 
-	// Add the metrics to the default registerer, user can change this later if
-	// they're using another.
+	if scrape {
+		// Metrics are collected through the Server, hold onto them here
+		// instead of in the registry.
+		for _, group := range s.groups() {
+			err := group.RegisterMetrics(&s.collectors)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err := s.meta.RegisterMetrics(&s.metaCollectors)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	return s, nil
+}
+
+// registerDefault adds the metrics to the default registerer, user can change
+// this later if they're using another.
+func (s *Server) registerDefault() error {
 	// NOTE: this will cause the default registry to contain the metric even if
 	// the user does change it. The usage here doesn't bump into any issue with
 	// this.
 	reg, ok := prometheus.DefaultRegisterer.(serverRegistry)
 	if !ok {
-		return nil, errors.New("unable to use default registry")
+		return errors.New("unable to use default registry")
 	}
-	err := s.RegisterMetrics(reg)
-	if err != nil {
-		return nil, err
-	}
-
-	return s, nil
+	return s.RegisterMetrics(reg)
 }
 
 // RegisterMetrics adds the Servers managed metrics to the provided registry and
@@ -80,15 +166,18 @@ func NewServer(gatherer *gather.Gatherer) (*Server, error) {
 func (s *Server) RegisterMetrics(reg serverRegistry) error {
 	s.registry = reg
 
-	groups := []interface {
-		RegisterMetrics(prometheus.Registerer) error
-	}{
-		s.upstream,
-		s.downstream,
-		s.device,
-		s.meta,
+	return s.registerCollectors(reg)
+}
+
+// registerCollectors adds the Servers managed metrics to the provided
+// registerer.
+func (s *Server) registerCollectors(reg prometheus.Registerer) error {
+	if s.scrape {
+		return reg.Register(s)
 	}
 
+	groups := append(s.groups(), s.meta)
+
 	for _, group := range groups {
 		err := group.RegisterMetrics(reg)
 		if err != nil {
@@ -99,46 +188,156 @@ func (s *Server) RegisterMetrics(reg serverRegistry) error {
 	return nil
 }
 
-func (s *Server) Collect() error {
+// logger prepares a log entry for the Server, identifying its target when
+// it's one of many.
+func (s *Server) logger(context string) *logrus.Entry {
+	log := logrus.WithField("context", context)
+	if s.target != "" {
+		log = log.WithField("target", s.target)
+	}
+	return log
+}
+
+// metricGroup is a set of metrics managed by the Server.
+type metricGroup interface {
+	RegisterMetrics(prometheus.Registerer) error
+}
+
+// groups lists the metrics recorded from collected device data.
+func (s *Server) groups() []metricGroup {
+	return []metricGroup{
+		s.upstream,
+		s.downstream,
+		s.device,
+		s.log,
+		s.startup,
+	}
+}
+
+// Update collects data from the device and records it in the Server's
+// metrics.
+func (s *Server) Update() error {
+	return s.UpdateContext(context.Background())
+}
+
+// UpdateContext collects data from the device and records it in the Server's
+// metrics, the context is used for the requests made to the device.
+func (s *Server) UpdateContext(ctx context.Context) error {
 	// TODO: track requests separately
 	spanTimer := prometheus.NewTimer(s.meta.CollectionTime)
 	defer func() {
 		spanTimer.ObserveDuration()
-		logrus.WithFields(logrus.Fields{
-			"context": "collect",
-		}).Info("finished collecting")
+		s.logger("collect").Info("finished collecting")
 	}()
 
-	err := s.gatherer.Login()
-	if err != nil {
-		return err
+	// Reuse the existing session, logging in only when there isn't one or
+	// the device has expired it.
+	if !s.gatherer.LoggedIn() {
+		err := s.login(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	collect, err := s.gatherer.GatherContext(ctx)
+	if errors.Is(err, gather.ErrSessionExpired) {
+		s.logger("collect").Info("login session expired")
+		err = s.login(ctx)
+		if err != nil {
+			return err
+		}
+		collect, err = s.gatherer.GatherContext(ctx)
 	}
-	collect, err := s.gatherer.Gather()
 	if err != nil {
+		var parseErr *gather.ParseError
+		if errors.As(err, &parseErr) {
+			s.meta.RecordFailure(stageParse)
+		} else {
+			s.meta.RecordFailure(stageGather)
+		}
 		return err
 	}
 
-	for _, info := range collect.Downstream {
-		s.downstream.RecordOne(&info)
-	}
+	s.downstream.RecordUptime(collect.Uptime, collect.UptimeKnown)
+	s.downstream.Record(collect.Downstream)
+	s.downstream.RecordCounts(collect.DeclaredDownstream, collect.Downstream)
 
-	for _, info := range collect.Upstream {
-		s.upstream.RecordOne(&info)
-	}
+	s.upstream.Record(collect.Upstream)
+	s.upstream.RecordCounts(collect.DeclaredUpstream, collect.Upstream)
 
 	s.device.RecordOne(collect)
+	// The log's new entries are found by comparing with the last log
+	// collected, keep it until the log is available again.
+	if collect.Available(hnap.GetMotoStatusLog) {
+		s.log.Record(collect.Log)
+	}
+	s.startup.RecordOne(&collect.Startup)
+
+	s.meta.RecordParseErrors(collect.ParseErrors)
+	s.meta.RecordUnavailable(collect.Unavailable)
+	s.meta.RecordSuccess()
 
 	return nil
 }
 
+// SetInterval configures the interval collections are made on.
+func (s *Server) SetInterval(interval time.Duration) {
+	s.interval = interval
+}
+
+// SetScrapeTimeout configures the time allowed to collect from the device
+// when scraped.
+func (s *Server) SetScrapeTimeout(timeout time.Duration) {
+	s.scrapeTimeout = timeout
+}
+
+// SetRetryPolicy configures the retries made when collecting on an interval.
+func (s *Server) SetRetryPolicy(policy RetryPolicy) {
+	s.retry = policy
+}
+
+// login starts a new login session with the device.
+func (s *Server) login(ctx context.Context) error {
+	s.meta.Logins.Inc()
+	err := s.gatherer.LoginContext(ctx)
+	if err != nil {
+		s.meta.RecordFailure(stageLogin)
+		return err
+	}
+	return nil
+}
+
 func (s *Server) Run(ctx context.Context, addr string) error {
+	var loops []func(context.Context) error
+	if s.scrape {
+		s.logger("server").Info("collecting from device on scrape")
+	} else {
+		loops = append(loops, s.collectLoop)
+	}
+
+	return serve(ctx, addr, s.registry, s.handlers, loops)
+}
+
+// Handle adds a handler to be served alongside the metrics.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	if s.handlers == nil {
+		s.handlers = map[string]http.Handler{}
+	}
+	s.handlers[pattern] = handler
+}
+
+// serve runs an HTTP server for the registry's metrics and the handlers along
+// with the given collection loops, until the context is cancelled.
+func serve(ctx context.Context, addr string, registry prometheus.Gatherer, handlers map[string]http.Handler, loops []func(context.Context) error) error {
 	log := logrus.WithField("context", "server")
 
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{
 		ErrorLog:      log.WithField("handler", "prometheus"),
 		ErrorHandling: promhttp.ContinueOnError,
 	}))
+	for pattern, handler := range handlers {
+		mux.Handle(pattern, handler)
+	}
 
 	srv := &http.Server{
 		Addr:    addr,
@@ -159,40 +358,19 @@ func (s *Server) Run(ctx context.Context, addr string) error {
 	defer cancel()
 
 	group, groupCtx := errgroup.WithContext(collectCtx)
-	group.Go(func() error {
-		log := log.WithField("context", "collect")
-		ticker := time.NewTicker(time.Second * 30)
-		defer ticker.Stop()
-
-		collect := func() {
-			// TODO: add retry handling
-			log.Info("collecting")
-			err := s.Collect()
-			if err != nil {
-				log.WithError(err).Error("collection error")
-				return
-			}
-			log.Info("completed successfully")
-		}
-
-		collect()
-
-		for {
-			select {
-			case <-ticker.C:
-				collect()
-			case <-collectCtx.Done():
-				return nil
-			}
-		}
-	})
-
-	go func() {
-		<-groupCtx.Done()
-	}()
+	for _, loop := range loops {
+		loop := loop
+		group.Go(func() error {
+			return loop(groupCtx)
+		})
+	}
 
 	<-ctx.Done()
-	<-groupCtx.Done()
+	// In-flight requests to the device are cancelled along with the context,
+	// wait for the collection to wind down.
+	if err := group.Wait(); err != nil {
+		log.WithError(err).Error("collection error")
+	}
 
 	const shutdownTimeout = time.Second * 5
 	log.Info("shutting down server")
@@ -213,16 +391,57 @@ func (s *Server) Run(ctx context.Context, addr string) error {
 	return serverErr
 }
 
+// collectLoop collects from the device on an interval until the context is
+// cancelled.
+func (s *Server) collectLoop(ctx context.Context) error {
+	log := s.logger("collect")
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	collect := func() {
+		log.Info("collecting")
+		err := s.retry.Do(ctx, func() error {
+			return s.UpdateContext(ctx)
+		}, func(attempt int, err error) {
+			s.meta.Retries.Inc()
+		})
+		if err != nil {
+			log.WithError(err).Error("collection error")
+			return
+		}
+		log.Info("completed successfully")
+	}
+
+	collect()
+
+	for {
+		select {
+		case <-ticker.C:
+			collect()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
 // metaMetrics are internal metrics having to do with the server and collection
 // process, ie: not the collected data.
 type metaMetrics struct {
 	CollectionTime prometheus.Histogram
+	// 0 or 1
+	Up                 prometheus.Gauge
+	Errors             *prometheus.CounterVec
+	LastSuccessfulTime prometheus.Gauge
+	Logins             prometheus.Counter
+	Retries            prometheus.Counter
+	ParseErrors        *prometheus.CounterVec
+	Unavailable        *prometheus.CounterVec
 }
 
 // NewMetaMetrics prepares a set of metrics for tracking internal server and
 // collection process metrics.
 func NewMetaMetrics() *metaMetrics {
-	return &metaMetrics{
+	m := &metaMetrics{
 		CollectionTime: prometheus.NewHistogram(prometheus.HistogramOpts{
 			Namespace: namespace,
 			Subsystem: "collection",
@@ -230,13 +449,76 @@ func NewMetaMetrics() *metaMetrics {
 			Buckets:   []float64{1, 5, 10, 15, 30, 45, 60},
 			Help:      "time taken to perform collection from device in seconds",
 		}),
+		Up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "up",
+			Help:      "whether the last collection from the device succeeded",
+		}),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "collection",
+			Name:      "errors_total",
+			Help:      "number of failed collections by the stage that failed",
+		}, []string{
+			labelStage,
+		}),
+		LastSuccessfulTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_successful_collection_timestamp_seconds",
+			Help:      "time of the last successful collection in seconds since the epoch",
+		}),
+		Logins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "number of login sessions started with the device",
+		}),
+		Retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "collection",
+			Name:      "retries_total",
+			Help:      "number of collections retried after a transient error",
+		}),
+		ParseErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "parse_errors_total",
+			Help:      "number of table rows left out of collections after failing to parse",
+		}, []string{
+			labelTable,
+		}),
+		Unavailable: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "action_unavailable_total",
+			Help:      "number of collections made without an optional action the device didn't respond to",
+		}, []string{
+			labelAction,
+		}),
+	}
+
+	// Export each stage's errors before the first failure.
+	for _, stage := range []string{stageLogin, stageGather, stageParse} {
+		m.Errors.WithLabelValues(stage)
+	}
+	for _, table := range []string{hnap.TableDownstream, hnap.TableUpstream, hnap.TableLog} {
+		m.ParseErrors.WithLabelValues(table)
 	}
+	for _, action := range gather.OptionalActions {
+		m.Unavailable.WithLabelValues(action)
+	}
+
+	return m
 }
 
 // RegisterMetrics adds metrics to the provided registry.
 func (m *metaMetrics) RegisterMetrics(reg prometheus.Registerer) error {
 	cs := []prometheus.Collector{
 		m.CollectionTime,
+		m.Up,
+		m.Errors,
+		m.LastSuccessfulTime,
+		m.Logins,
+		m.Retries,
+		m.ParseErrors,
+		m.Unavailable,
 	}
 
 	for _, c := range cs {
@@ -249,17 +531,47 @@ func (m *metaMetrics) RegisterMetrics(reg prometheus.Registerer) error {
 	return nil
 }
 
+// RecordSuccess records a successful collection.
+func (m *metaMetrics) RecordSuccess() {
+	m.Up.Set(1)
+	m.LastSuccessfulTime.SetToCurrentTime()
+}
+
+// RecordParseErrors records the table rows left out of a collection.
+func (m *metaMetrics) RecordParseErrors(errs []hnap.RowError) {
+	for _, err := range errs {
+		m.ParseErrors.WithLabelValues(err.Table).Inc()
+	}
+}
+
+// RecordUnavailable records the optional actions left out of a collection.
+func (m *metaMetrics) RecordUnavailable(actions []string) {
+	for _, action := range actions {
+		m.Unavailable.WithLabelValues(action).Inc()
+	}
+}
+
+// RecordFailure records a collection that failed at the given stage.
+func (m *metaMetrics) RecordFailure(stage string) {
+	m.Up.Set(0)
+	m.Errors.WithLabelValues(stage).Inc()
+}
+
 // downstreamMetrics are the metrics maintained for Downstream Channels.
 type downstreamMetrics struct {
 	// 0 or 1
-	Locked    *prometheus.GaugeVec
-	Frequency *prometheus.GaugeVec
-	// TODO: make these counters with Set(), the standard Counter does not allow
-	// this.
-	Uncorrected *prometheus.GaugeVec
-	Corrected   *prometheus.GaugeVec
+	Locked      *prometheus.GaugeVec
+	Frequency   *prometheus.GaugeVec
+	Uncorrected *deviceCounterVec
+	Corrected   *deviceCounterVec
 	Signal      *prometheus.GaugeVec
 	Power       *prometheus.GaugeVec
+
+	Declared       prometheus.Gauge
+	LockedChannels prometheus.Gauge
+
+	Dropped prometheus.Counter
+	series  seriesSet
 }
 
 func NewDownstreamMetrics() *downstreamMetrics {
@@ -284,13 +596,13 @@ func NewDownstreamMetrics() *downstreamMetrics {
 			Name:      "frequency",
 			Help:      "channel frequency in Hz",
 		}, labels),
-		Corrected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Corrected: newDeviceCounterVec(prometheus.CounterOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
 			Name:      "corrected_total",
 			Help:      "corrected symbols",
 		}, labels),
-		Uncorrected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Uncorrected: newDeviceCounterVec(prometheus.CounterOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
 			Name:      "uncorrected_total",
@@ -308,6 +620,24 @@ func NewDownstreamMetrics() *downstreamMetrics {
 			Name:      "power_dbmv",
 			Help:      "channel power level in dBmV",
 		}, labels),
+		Declared: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "downstream",
+			Name:      "channels_declared",
+			Help:      "number of downstream channels advertised by the device",
+		}),
+		LockedChannels: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "downstream",
+			Name:      "channels_locked",
+			Help:      "number of downstream channels reported as locked",
+		}),
+		Dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "downstream",
+			Name:      "channel_series_dropped_total",
+			Help:      "number of downstream channels removed after no longer being reported",
+		}),
 	}
 }
 
@@ -319,6 +649,9 @@ func (m *downstreamMetrics) RegisterMetrics(reg prometheus.Registerer) error {
 		m.Corrected,
 		m.Signal,
 		m.Power,
+		m.Declared,
+		m.LockedChannels,
+		m.Dropped,
 	}
 
 	for _, c := range cs {
@@ -331,33 +664,79 @@ func (m *downstreamMetrics) RegisterMetrics(reg prometheus.Registerer) error {
 	return nil
 }
 
+// Record records the collected channels, removing any channels that are no
+// longer reported.
+func (m *downstreamMetrics) Record(channels []hnap.DownstreamInfo) {
+	for _, info := range channels {
+		m.RecordOne(&info)
+	}
+
+	stale := m.series.Sweep()
+	for _, labels := range stale {
+		m.Locked.Delete(labels)
+		m.Frequency.Delete(labels)
+		m.Power.Delete(labels)
+		m.Corrected.Delete(labels)
+		m.Uncorrected.Delete(labels)
+		m.Signal.Delete(labels)
+	}
+	m.Dropped.Add(float64(len(stale)))
+}
+
 func (m *downstreamMetrics) RecordOne(info *hnap.DownstreamInfo) {
-	// TODO: insert metrics from info
 	labels := prometheus.Labels{
 		labelChannel:    fmt.Sprintf("%d", info.ID),
 		labelChannelID:  fmt.Sprintf("%d", info.ChannelID),
 		labelModulation: info.Modulation,
 	}
+	m.series.Add(labels)
 
 	var locked float64
-	if info.LockStatus == "Locked" {
+	if info.LockStatus == hnap.Locked {
 		locked = 1
 	}
 
 	m.Locked.With(labels).Set(locked)
 	m.Frequency.With(labels).Set(info.Frequency)
 	m.Power.With(labels).Set(info.DecibelMillivolts)
-	m.Corrected.With(labels).Set(float64(info.Corrected))
-	m.Uncorrected.With(labels).Set(float64(info.Uncorrected))
+	m.Corrected.Observe(labels, info.Corrected)
+	m.Uncorrected.Observe(labels, info.Uncorrected)
 	m.Signal.With(labels).Set(info.Signal)
 }
 
+// RecordUptime records the device's uptime ahead of its channels, the codeword
+// counters use it to tell a reboot from a wraparound.
+func (m *downstreamMetrics) RecordUptime(uptime time.Duration, known bool) {
+	m.Corrected.ObserveUptime(uptime, known)
+	m.Uncorrected.ObserveUptime(uptime, known)
+}
+
+// RecordCounts records the advertised number of channels alongside the number
+// of channels actually locked.
+func (m *downstreamMetrics) RecordCounts(declared int64, channels []hnap.DownstreamInfo) {
+	var locked int
+	for _, info := range channels {
+		if info.LockStatus == hnap.Locked {
+			locked++
+		}
+	}
+
+	m.Declared.Set(float64(declared))
+	m.LockedChannels.Set(float64(locked))
+}
+
 type upstreamMetrics struct {
 	// 0 or 1
 	Locked     *prometheus.GaugeVec
 	Frequency  *prometheus.GaugeVec
 	SymbolRate *prometheus.GaugeVec
 	Power      *prometheus.GaugeVec
+
+	Declared       prometheus.Gauge
+	LockedChannels prometheus.Gauge
+
+	Dropped prometheus.Counter
+	series  seriesSet
 }
 
 // upstreamMetrics are the metrics maintained for Downstream Channels.
@@ -395,6 +774,24 @@ func NewUpstreamMetrics() *upstreamMetrics {
 			Name:      "power_dbmv",
 			Help:      "channel power level in dBmV",
 		}, labels),
+		Declared: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "channels_declared",
+			Help:      "number of upstream channels advertised by the device",
+		}),
+		LockedChannels: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "channels_locked",
+			Help:      "number of upstream channels reported as locked",
+		}),
+		Dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "channel_series_dropped_total",
+			Help:      "number of upstream channels removed after no longer being reported",
+		}),
 	}
 }
 
@@ -404,6 +801,9 @@ func (m *upstreamMetrics) RegisterMetrics(reg prometheus.Registerer) error {
 		m.Frequency,
 		m.SymbolRate,
 		m.Power,
+		m.Declared,
+		m.LockedChannels,
+		m.Dropped,
 	}
 
 	for _, c := range cs {
@@ -416,15 +816,33 @@ func (m *upstreamMetrics) RegisterMetrics(reg prometheus.Registerer) error {
 	return nil
 }
 
+// Record records the collected channels, removing any channels that are no
+// longer reported.
+func (m *upstreamMetrics) Record(channels []hnap.UpstreamInfo) {
+	for _, info := range channels {
+		m.RecordOne(&info)
+	}
+
+	stale := m.series.Sweep()
+	for _, labels := range stale {
+		m.Locked.Delete(labels)
+		m.Frequency.Delete(labels)
+		m.SymbolRate.Delete(labels)
+		m.Power.Delete(labels)
+	}
+	m.Dropped.Add(float64(len(stale)))
+}
+
 func (m *upstreamMetrics) RecordOne(info *hnap.UpstreamInfo) {
 	labels := prometheus.Labels{
 		labelChannel:    fmt.Sprintf("%d", info.ID),
 		labelChannelID:  fmt.Sprintf("%d", info.Channel),
 		labelModulation: info.Modulation,
 	}
+	m.series.Add(labels)
 
 	var locked float64
-	if info.LockStatus == "Locked" {
+	if info.LockStatus == hnap.Locked {
 		locked = 1
 	}
 
@@ -434,9 +852,34 @@ func (m *upstreamMetrics) RecordOne(info *hnap.UpstreamInfo) {
 	m.Power.With(labels).Set(info.DecibelMillivolts)
 }
 
+// RecordCounts records the advertised number of channels alongside the number
+// of channels actually locked.
+func (m *upstreamMetrics) RecordCounts(declared int64, channels []hnap.UpstreamInfo) {
+	var locked int
+	for _, info := range channels {
+		if info.LockStatus == hnap.Locked {
+			locked++
+		}
+	}
+
+	m.Declared.Set(float64(declared))
+	m.LockedChannels.Set(float64(locked))
+}
+
 type deviceMetrics struct {
-	Device    *prometheus.GaugeVec
-	Connected *prometheus.GaugeVec
+	Device        *prometheus.GaugeVec
+	Connected     *prometheus.GaugeVec
+	Uptime        *prometheus.GaugeVec
+	BootTime      *prometheus.GaugeVec
+	NetworkAccess *prometheus.GaugeVec
+	LagAggregated *prometheus.GaugeVec
+
+	Address        *prometheus.GaugeVec
+	AddressChanges *prometheus.CounterVec
+
+	// lastAddress is the address labels from the previous collection, used
+	// to detect changes.
+	lastAddress prometheus.Labels
 }
 
 // deviceMetrics are the metrics maintained for Downstream Channels.
@@ -465,6 +908,57 @@ func NewDeviceMetrics() *deviceMetrics {
 		}, []string{
 			labelSerial,
 		}),
+		Uptime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "uptime_seconds",
+			Help:      "device uptime in seconds",
+		}, []string{
+			labelSerial,
+		}),
+		BootTime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "boot_time_seconds",
+			Help:      "device boot time in seconds since the epoch, derived from uptime",
+		}, []string{
+			labelSerial,
+		}),
+		NetworkAccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "network_access_allowed",
+			Help:      "device network access allowed by the provider",
+		}, []string{
+			labelSerial,
+		}),
+		LagAggregated: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "lag_aggregated",
+			Help:      "whether the device is aggregating its ethernet ports (link aggregation)",
+		}, []string{
+			labelSerial,
+		}),
+		Address: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "address_info",
+			Help:      "device WAN addresses",
+		}, []string{
+			labelSerial,
+			labelHWAddr,
+			labelIPv4,
+			labelIPv6,
+		}),
+		AddressChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "address_changes_total",
+			Help:      "number of times the device WAN addresses were observed to change",
+		}, []string{
+			labelSerial,
+		}),
 	}
 }
 
@@ -472,6 +966,12 @@ func (m *deviceMetrics) RegisterMetrics(reg prometheus.Registerer) error {
 	cs := []prometheus.Collector{
 		m.Device,
 		m.Connected,
+		m.Uptime,
+		m.BootTime,
+		m.NetworkAccess,
+		m.LagAggregated,
+		m.Address,
+		m.AddressChanges,
 	}
 
 	for _, c := range cs {
@@ -501,4 +1001,245 @@ func (m *deviceMetrics) RecordOne(info *gather.Collection) {
 	m.Connected.With(prometheus.Labels{
 		labelSerial: info.SerialNumber,
 	}).Set(connected)
+
+	serial := prometheus.Labels{
+		labelSerial: info.SerialNumber,
+	}
+	if info.UptimeKnown {
+		m.Uptime.With(serial).Set(info.Uptime.Seconds())
+
+		// Uptime is only reported to the second, truncate to keep the boot
+		// time from jittering between collections.
+		bootTime := time.Now().Add(-info.Uptime).Truncate(time.Second)
+		m.BootTime.With(serial).Set(float64(bootTime.Unix()))
+	} else {
+		// Don't leave the last known uptime behind as if it were current.
+		m.Uptime.Delete(serial)
+		m.BootTime.Delete(serial)
+	}
+
+	var allowed float64
+	if info.NetworkAccessAllowed {
+		allowed = 1
+	}
+	m.NetworkAccess.With(prometheus.Labels{
+		labelSerial: info.SerialNumber,
+	}).Set(allowed)
+
+	if info.Available(hnap.GetMotoLagStatus) {
+		var aggregated float64
+		if info.LagAggregated {
+			aggregated = 1
+		}
+		m.LagAggregated.With(serial).Set(aggregated)
+	} else {
+		// Models without LAG don't report its status.
+		m.LagAggregated.Delete(serial)
+	}
+
+	address := prometheus.Labels{
+		labelSerial: info.SerialNumber,
+		labelHWAddr: info.HWAddr,
+		labelIPv4:   ipString(info.IPv4),
+		labelIPv6:   ipString(info.IPv6),
+	}
+	// Initialize the counter so it's exported before the first change.
+	changes := m.AddressChanges.With(prometheus.Labels{
+		labelSerial: info.SerialNumber,
+	})
+	m.Address.With(address).Set(1)
+	if m.lastAddress != nil && !labelsEqual(m.lastAddress, address) {
+		changes.Inc()
+		// Only the current address should be reported, the new address is
+		// set first so it's never missing from a concurrent scrape.
+		m.Address.Delete(m.lastAddress)
+	}
+	m.lastAddress = address
+}
+
+// ipString formats the IP for use as a label value, unset addresses are left
+// empty.
+func ipString(ip net.IP) string {
+	if len(ip) == 0 {
+		return ""
+	}
+	return ip.String()
+}
+
+func labelsEqual(a, b prometheus.Labels) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// startupMetrics are the metrics maintained for the device's startup sequence.
+type startupMetrics struct {
+	// 0 or 1
+	StepOK              *prometheus.GaugeVec
+	DownstreamFrequency prometheus.Gauge
+
+	// stepSeries are the StepOK series of the current startup sequence.
+	stepSeries seriesSet
+}
+
+func NewStartupMetrics() *startupMetrics {
+	const subsystem = "startup"
+
+	return &startupMetrics{
+		StepOK: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "step_ok",
+			Help:      "startup sequence step status",
+		}, []string{
+			labelStep,
+			labelComment,
+		}),
+		DownstreamFrequency: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "downstream_frequency",
+			Help:      "primary downstream channel frequency in Hz",
+		}),
+	}
+}
+
+func (m *startupMetrics) RegisterMetrics(reg prometheus.Registerer) error {
+	cs := []prometheus.Collector{
+		m.StepOK,
+		m.DownstreamFrequency,
+	}
+
+	for _, c := range cs {
+		err := reg.Register(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *startupMetrics) RecordOne(info *hnap.MotoStatusStartupSequenceResponse) {
+	for _, step := range info.Steps() {
+		var ok float64
+		if step.OK() {
+			ok = 1
+		}
+		labels := prometheus.Labels{
+			labelStep:    step.Name,
+			labelComment: step.Comment,
+		}
+		m.stepSeries.Add(labels)
+		m.StepOK.With(labels).Set(ok)
+	}
+	// Comments change along with the status, drop the steps' previous
+	// comments so only the current comment is exported.
+	for _, labels := range m.stepSeries.Sweep() {
+		m.StepOK.Delete(labels)
+	}
+
+	m.DownstreamFrequency.Set(info.DownstreamFrequencyHZ())
+}
+
+// logMetrics are the metrics maintained for the device's event log.
+type logMetrics struct {
+	Entries *prometheus.GaugeVec
+	Events  *prometheus.CounterVec
+
+	// seen holds the entries observed in the previous collection, the log is a
+	// rolling window so only entries not seen before are counted as events.
+	// It's nil until the first collection.
+	seen map[string]struct{}
+	// entrySeries are the Entries series of the current log.
+	entrySeries seriesSet
+}
+
+func NewLogMetrics() *logMetrics {
+	const subsystem = "log"
+
+	labels := []string{
+		labelPriority,
+		labelEvent,
+	}
+
+	return &logMetrics{
+		Entries: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "entries",
+			Help:      "number of entries currently held in the device event log",
+		}, labels),
+		Events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "events_total",
+			Help:      "number of new entries observed in the device event log",
+		}, labels),
+	}
+}
+
+func (m *logMetrics) RegisterMetrics(reg prometheus.Registerer) error {
+	cs := []prometheus.Collector{
+		m.Entries,
+		m.Events,
+	}
+
+	for _, c := range cs {
+		err := reg.Register(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *logMetrics) Record(entries []hnap.LogEntry) {
+	counts := map[string]float64{}
+	series := map[string]prometheus.Labels{}
+	seen := make(map[string]struct{}, len(entries))
+	// occurrences counts the entries logged identically, ie: repeated
+	// "Time Not Established" entries, so each is keyed separately.
+	occurrences := map[string]int{}
+	for _, entry := range entries {
+		labels := prometheus.Labels{
+			labelPriority: strings.ToLower(entry.Priority),
+			labelEvent:    entry.Event(),
+		}
+
+		m.entrySeries.Add(labels)
+		series[labelsKey(labels)] = labels
+		counts[labelsKey(labels)]++
+
+		entryKey := strings.Join([]string{entry.Timestamp, entry.Priority, entry.Description}, "\x00")
+		key := fmt.Sprintf("%s\x00%d", entryKey, occurrences[entryKey])
+		occurrences[entryKey]++
+
+		// Entries already in the log on the first collection, ie: after the
+		// exporter restarts, aren't new to the device and aren't counted.
+		// Their series start from zero so later events show as an increase.
+		events := m.Events.With(labels)
+		if _, ok := m.seen[key]; !ok && m.seen != nil {
+			events.Inc()
+		}
+		seen[key] = struct{}{}
+	}
+
+	for key, labels := range series {
+		m.Entries.With(labels).Set(counts[key])
+	}
+	// Entries are a snapshot of the log, drop counts for entries that have
+	// rolled out of it.
+	for _, labels := range m.entrySeries.Sweep() {
+		m.Entries.Delete(labels)
+	}
+
+	m.seen = seen
 }
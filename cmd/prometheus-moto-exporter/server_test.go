@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/gather"
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap/hnaptest"
+)
+
+func newTestServer(t *testing.T, scrape bool) (*hnaptest.Server, *Server) {
+	modem := hnaptest.NewServer()
+	t.Cleanup(modem.Close)
+
+	gatherer, err := gather.New(modem.Endpoint(), hnaptest.DefaultUsername, hnaptest.DefaultPassword)
+	require.NoError(t, err)
+
+	srv, err := newServer(gatherer, scrape)
+	require.NoError(t, err)
+	require.NoError(t, srv.RegisterMetrics(prometheus.NewRegistry()))
+
+	return modem, srv
+}
+
+func TestServerUpdateSessionExpired(t *testing.T) {
+	modem, srv := newTestServer(t, false)
+	ctx := context.Background()
+
+	require.NoError(t, srv.UpdateContext(ctx))
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, 1, modem.Logins(), "the login session is reused")
+
+	modem.ExpireSessions()
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, 2, modem.Logins())
+	assert.Equal(t, float64(2), testutil.ToFloat64(srv.meta.Logins))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.Up))
+}
+
+func TestServerUpdateFailureStage(t *testing.T) {
+	modem, srv := newTestServer(t, false)
+	ctx := context.Background()
+
+	modem.RemoveAction(hnap.GetMotoStatusDownstreamChannelInfo)
+	assert.Error(t, srv.UpdateContext(ctx))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.Errors.WithLabelValues(stageParse)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(srv.meta.Up))
+
+	modem.SetCredentials(hnaptest.DefaultUsername, "changed")
+	modem.ExpireSessions()
+	assert.Error(t, srv.UpdateContext(ctx))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.Errors.WithLabelValues(stageLogin)))
+}
+
+func TestServerUpdateUnknownUptime(t *testing.T) {
+	modem, srv := newTestServer(t, false)
+	ctx := context.Background()
+
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, 1, testutil.CollectAndCount(srv.device.Uptime))
+
+	modem.SetField(hnap.GetMotoStatusConnectionInfo, "MotoConnSystemUpTime", "forever")
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, 0, testutil.CollectAndCount(srv.device.Uptime))
+	assert.Equal(t, 0, testutil.CollectAndCount(srv.device.BootTime))
+	assert.Equal(t, 33, testutil.CollectAndCount(srv.downstream.Locked), "channel metrics are kept")
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.Up))
+}
+
+func TestServerUpdateUnavailableAction(t *testing.T) {
+	modem, srv := newTestServer(t, false)
+	ctx := context.Background()
+
+	require.NoError(t, srv.UpdateContext(ctx))
+	events := srv.log.Events.WithLabelValues("critical", hnap.LogEventT3Timeout)
+	assert.Equal(t, float64(0), testutil.ToFloat64(events), "entries logged before the first collection aren't counted")
+
+	modem.SetField(hnap.GetMotoStatusLog, hnap.GetMotoStatusLog+"Result", "ERROR")
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.Unavailable.WithLabelValues(hnap.GetMotoStatusLog)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.Up))
+
+	modem.SetField(hnap.GetMotoStatusLog, hnap.GetMotoStatusLog+"Result", "OK")
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, float64(0), testutil.ToFloat64(events), "entries aren't counted again once the log is available")
+}
+
+func TestServerUpdateStartupComment(t *testing.T) {
+	modem, srv := newTestServer(t, false)
+	ctx := context.Background()
+
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, 5, testutil.CollectAndCount(srv.startup.StepOK))
+
+	modem.SetField(hnap.GetMotoStatusStartupSequence, "MotoConnBootStatus", "In Progress")
+	modem.SetField(hnap.GetMotoStatusStartupSequence, "MotoConnBootComment", "Registration")
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, 5, testutil.CollectAndCount(srv.startup.StepOK), "the previous comment is dropped")
+	assert.Equal(t, float64(0), testutil.ToFloat64(srv.startup.StepOK.WithLabelValues(hnap.StartupStepBoot, "Registration")))
+}
+
+func TestServerUpdateAddressChange(t *testing.T) {
+	modem, srv := newTestServer(t, false)
+	ctx := context.Background()
+
+	require.NoError(t, srv.UpdateContext(ctx))
+	changes := srv.device.AddressChanges.WithLabelValues("REDACTED")
+	assert.Equal(t, float64(0), testutil.ToFloat64(changes))
+
+	modem.SetField(hnap.GetHomeAddress, "MotoHomeIpAddress", "192.0.2.20")
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, float64(1), testutil.ToFloat64(changes))
+	require.Equal(t, 1, testutil.CollectAndCount(srv.device.Address), "only the new address is reported")
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.device.Address.With(srv.device.lastAddress)))
+	assert.Equal(t, "192.0.2.20", srv.device.lastAddress[labelIPv4])
+
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, float64(1), testutil.ToFloat64(changes), "an unchanged address isn't counted")
+}
+
+func TestServerUpdateRebondedChannel(t *testing.T) {
+	modem, srv := newTestServer(t, false)
+	ctx := context.Background()
+
+	require.NoError(t, srv.UpdateContext(ctx))
+	downstream := prometheus.Labels{labelChannel: "1", labelChannelID: "33", labelModulation: "QAM256"}
+	upstream := prometheus.Labels{labelChannel: "1", labelChannelID: "1", labelModulation: "SC-QAM"}
+	assert.True(t, hasSeries(t, srv.downstream.Corrected, downstream))
+	assert.True(t, hasSeries(t, srv.upstream.Power, upstream))
+
+	// Channel 1 is rebonded to another downstream channel ID and upstream
+	// modulation.
+	table := fixtureField(t, hnap.GetMotoStatusDownstreamChannelInfo, "MotoConnDownstreamChannel")
+	modem.SetField(hnap.GetMotoStatusDownstreamChannelInfo, "MotoConnDownstreamChannel",
+		strings.Replace(table, "1^Locked^QAM256^33^", "1^Locked^QAM256^40^", 1))
+	table = fixtureField(t, hnap.GetMotoStatusUpstreamChannelInfo, "MotoConnUpstreamChannel")
+	modem.SetField(hnap.GetMotoStatusUpstreamChannelInfo, "MotoConnUpstreamChannel",
+		strings.Replace(table, "1^Locked^SC-QAM^1^", "1^Locked^OFDMA^1^", 1))
+	require.NoError(t, srv.UpdateContext(ctx))
+
+	for _, c := range []prometheus.Collector{srv.downstream.Locked, srv.downstream.Frequency, srv.downstream.Power, srv.downstream.Signal, srv.downstream.Corrected, srv.downstream.Uncorrected} {
+		assert.False(t, hasSeries(t, c, downstream), "the stale series is removed")
+		assert.Equal(t, 33, testutil.CollectAndCount(c))
+	}
+	assert.True(t, hasSeries(t, srv.downstream.Corrected, prometheus.Labels{labelChannel: "1", labelChannelID: "40", labelModulation: "QAM256"}))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.downstream.Dropped))
+
+	for _, c := range []prometheus.Collector{srv.upstream.Locked, srv.upstream.Frequency, srv.upstream.SymbolRate, srv.upstream.Power} {
+		assert.False(t, hasSeries(t, c, upstream), "the stale series is removed")
+		assert.Equal(t, 4, testutil.CollectAndCount(c))
+	}
+	assert.True(t, hasSeries(t, srv.upstream.Power, prometheus.Labels{labelChannel: "1", labelChannelID: "1", labelModulation: "OFDMA"}))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.upstream.Dropped))
+}
+
+// hasSeries reports whether the collector has a series with the labels.
+func hasSeries(t *testing.T, c prometheus.Collector, labels prometheus.Labels) bool {
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(c))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			found := prometheus.Labels{}
+			for _, pair := range metric.GetLabel() {
+				found[pair.GetName()] = pair.GetValue()
+			}
+			if labelsEqual(found, labels) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fixtureField gets the field of the action's response in the fake modem's
+// default fixture.
+func fixtureField(t *testing.T, action, field string) string {
+	var fixture hnap.GetMultipleHNAPsResponse
+	require.NoError(t, json.Unmarshal(hnaptest.DefaultFixture, &fixture))
+	var response map[string]interface{}
+	require.NoError(t, fixture.Decode(action, &response))
+	value, ok := response[field].(string)
+	require.True(t, ok, "%s.%s is in the fixture", action, field)
+	return value
+}
+
+func TestServerUpdateLagStatus(t *testing.T) {
+	modem, srv := newTestServer(t, false)
+	ctx := context.Background()
+
+	modem.SetField(hnap.GetMotoLagStatus, "MotoLagCurrentStatus", "1")
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.device.LagAggregated))
+
+	modem.SetField(hnap.GetMotoLagStatus, "MotoLagCurrentStatus", "")
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, float64(0), testutil.ToFloat64(srv.device.LagAggregated))
+
+	modem.RemoveAction(hnap.GetMotoLagStatus)
+	require.NoError(t, srv.UpdateContext(ctx))
+	assert.Equal(t, 0, testutil.CollectAndCount(srv.device.LagAggregated))
+}
+
+func TestServerUpdateParseErrors(t *testing.T) {
+	modem, srv := newTestServer(t, false)
+
+	modem.SetField(hnap.GetMotoStatusUpstreamChannelInfo, "MotoConnUpstreamChannel", "1^Locked^SC-QAM^1^5120^17.3^58.8^|+|2^Locked^OFDMA^")
+	require.NoError(t, srv.UpdateContext(context.Background()))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.ParseErrors.WithLabelValues(hnap.TableUpstream)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(srv.meta.ParseErrors.WithLabelValues(hnap.TableDownstream)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.Up))
+}
+
+func TestLogMetricsRepeatedEntries(t *testing.T) {
+	m := NewLogMetrics()
+	notEstablished := hnap.LogEntry{Timestamp: "Time Not Established", Priority: "Critical", Description: "No Ranging Response received - T3 time-out"}
+	events := m.Events.WithLabelValues("critical", hnap.LogEventT3Timeout)
+
+	m.Record(nil)
+	m.Record([]hnap.LogEntry{notEstablished, notEstablished})
+	assert.Equal(t, float64(2), testutil.ToFloat64(events), "identical entries are each counted")
+
+	m.Record([]hnap.LogEntry{notEstablished, notEstablished, notEstablished})
+	assert.Equal(t, float64(3), testutil.ToFloat64(events), "only the new repeat is counted")
+}
+
+func TestLogMetricsRestart(t *testing.T) {
+	m := NewLogMetrics()
+	t3 := hnap.LogEntry{Timestamp: "18:26:54 Sun Nov 08 2020", Priority: "Critical", Description: "No Ranging Response received - T3 time-out"}
+	t4 := hnap.LogEntry{Timestamp: "18:27:54 Sun Nov 08 2020", Priority: "Critical", Description: "Received Response to Broadcast Maintenance Request, But no Unicast Maintenance opportunities received - T4 time out"}
+	events := m.Events.WithLabelValues("critical", hnap.LogEventT3Timeout)
+
+	// Entries already logged when the exporter starts aren't new events.
+	m.Record([]hnap.LogEntry{t3})
+	m.Record([]hnap.LogEntry{t3})
+	assert.Equal(t, float64(0), testutil.ToFloat64(events))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Entries.WithLabelValues("critical", hnap.LogEventT3Timeout)))
+
+	m.Record([]hnap.LogEntry{t3, t4})
+	assert.Equal(t, float64(0), testutil.ToFloat64(events))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Events.WithLabelValues("critical", hnap.LogEventT4Timeout)))
+
+	// Entries that roll out of the log are no longer held.
+	m.Record([]hnap.LogEntry{t4})
+	assert.Equal(t, 1, testutil.CollectAndCount(m.Entries))
+}
+
+func TestServerScrapeTimeout(t *testing.T) {
+	modem, srv := newTestServer(t, true)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, srv.RegisterMetrics(reg))
+
+	// The Server collects from the device when gathered by any registry.
+	_, err := reg.Gather()
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.Up))
+
+	// The collection is abandoned once the scrape times out.
+	srv.SetScrapeTimeout(100 * time.Millisecond)
+	modem.SetDelay(500 * time.Millisecond)
+	start := time.Now()
+	_, err = reg.Gather()
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+	assert.Equal(t, float64(0), testutil.ToFloat64(srv.meta.Up))
+}
+
+func TestServerScrapeShared(t *testing.T) {
+	modem, srv := newTestServer(t, true)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, srv.RegisterMetrics(reg))
+	handler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+
+	_, err := reg.Gather()
+	require.NoError(t, err)
+	calls := modem.Calls(hnap.GetMultipleHNAPs)
+
+	// Concurrent scrapes share a collection, one scraper giving up doesn't
+	// fail the others.
+	modem.SetDelay(200 * time.Millisecond)
+	abandoned, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if i == 0 {
+				req = req.WithContext(abandoned)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			codes[i] = rec.Code
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	assert.Equal(t, http.StatusOK, codes[1])
+	assert.Equal(t, calls+1, modem.Calls(hnap.GetMultipleHNAPs))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.meta.Up))
+}
@@ -0,0 +1,83 @@
+package gather
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Credentials are used to login to the device.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialProvider provides the Credentials used to login to the device.
+// Credentials are requested for each login so that providers are able to
+// rotate them.
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials provides fixed Credentials.
+type StaticCredentials Credentials
+
+func (c StaticCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	return Credentials(c), nil
+}
+
+// PasswordFile provides Credentials with the password read from a file, ie: a
+// mounted Docker or Kubernetes secret. The file is read when created and again
+// each time it's reloaded.
+type PasswordFile struct {
+	username string
+	path     string
+
+	mu       sync.RWMutex
+	password string
+}
+
+// NewPasswordFile creates a PasswordFile provider, reading the password from
+// the file at path.
+func NewPasswordFile(username, path string) (*PasswordFile, error) {
+	p := &PasswordFile{
+		username: username,
+		path:     path,
+	}
+
+	err := p.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Reload reads the password file again, the previous password is kept if the
+// file can't be read.
+func (p *PasswordFile) Reload() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("read password file: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Secrets are commonly written with a trailing newline.
+	p.password = strings.TrimRight(string(data), "\r\n")
+
+	return nil
+}
+
+func (p *PasswordFile) Credentials(ctx context.Context) (Credentials, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return Credentials{
+		Username: p.username,
+		Password: p.password,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package gather
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(path, []byte("first\n"), 0o600))
+
+	provider, err := NewPasswordFile("admin", path)
+	require.NoError(t, err)
+
+	creds, err := provider.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "admin", Password: "first"}, creds)
+
+	require.NoError(t, os.WriteFile(path, []byte("second"), 0o600))
+	require.NoError(t, provider.Reload())
+	creds, err = provider.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "second", creds.Password)
+
+	// A missing file keeps the last password.
+	require.NoError(t, os.Remove(path))
+	assert.Error(t, provider.Reload())
+	creds, err = provider.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "second", creds.Password)
+}
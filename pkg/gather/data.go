@@ -1,13 +1,49 @@
 package gather
 
-import "github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
+import (
+	"net"
+	"time"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
+)
 
 type Collection struct {
 	Upstream   []hnap.UpstreamInfo
 	Downstream []hnap.DownstreamInfo
+	Log        []hnap.LogEntry
+
+	// ParseErrors are the rows of the channel tables and event log that could
+	// not be parsed, these are left out of Upstream, Downstream and Log.
+	ParseErrors []hnap.RowError
+
+	// Unavailable are the optional actions that were missing from the
+	// device's response or failed, their data is left out.
+	Unavailable []string
 
 	Online bool
 
+	// Channel counts as advertised by the device, these may differ from the
+	// number of channels actually reported.
+	DeclaredDownstream int64
+	DeclaredUpstream   int64
+
+	// Uptime is the device's reported uptime at the time of collection.
+	Uptime time.Duration
+	// UptimeKnown reports whether the device reported an uptime that could be
+	// parsed, Uptime is zero otherwise.
+	UptimeKnown bool
+
+	NetworkAccessAllowed bool
+
+	// LagAggregated reports whether the device is aggregating its ethernet
+	// ports, unknown when GetMotoLagStatus is unavailable.
+	LagAggregated bool
+
+	// WAN addressing of the device.
+	HWAddr string
+	IPv4   net.IP
+	IPv6   net.IP
+
 	SerialNumber    string
 	SoftwareVersion string
 	HardwareVersion string
@@ -15,4 +51,16 @@ type Collection struct {
 
 	BootFile        string
 	CustomerVersion string
+
+	Startup hnap.MotoStatusStartupSequenceResponse
+}
+
+// Available reports whether the action's data is included in the Collection.
+func (c *Collection) Available(action string) bool {
+	for _, unavailable := range c.Unavailable {
+		if action == unavailable {
+			return false
+		}
+	}
+	return true
 }
@@ -1,19 +1,13 @@
 package gather
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/md5"
+	"context"
 	"crypto/tls"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
-	"sync"
+	"sort"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -21,186 +15,138 @@ import (
 	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
 )
 
-const hSOAPAction = "SOAPAction"
-const hHNAPAuth = "HNAP_AUTH"
+// ErrSessionExpired is returned when the device no longer accepts the login
+// session, the Gatherer must Login again.
+var ErrSessionExpired = hnap.ErrUnauthorized
 
-type Gatherer struct {
-	username string
-	password string
+// ErrLoginRejected is returned when the device rejects the login, ie: the
+// credentials are incorrect.
+var ErrLoginRejected = hnap.ErrLoginRejected
 
-	endpoint *url.URL
+// StatusError is returned when the device responds with an unexpected HTTP
+// status.
+type StatusError = hnap.StatusError
 
-	mu         *sync.RWMutex
-	privateKey []byte
-	client     *http.Client
+// ParseError is returned when the device responded but its response could not
+// be parsed.
+type ParseError struct {
+	Err error
 }
 
-func New(endpoint *url.URL, username, password string) (*Gatherer, error) {
-	return &Gatherer{
-		username: username,
-		password: password,
-		endpoint: endpoint,
-
-		mu: &sync.RWMutex{},
-
-		client: &http.Client{
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-			Jar: func() http.CookieJar { j, _ := cookiejar.New(nil); return j }(),
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-			},
-			Timeout: time.Second * 45,
-		},
-	}, nil
+func (e *ParseError) Error() string {
+	return e.Err.Error()
 }
 
-func (g *Gatherer) Login() error {
-	const (
-		loginAction = "Login"
-		loginURI    = "http://purenetworks.com/HNAP1/Login"
-	)
-
-	log := logrus.WithField("action", "login")
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
 
-	// 1. Request challenge, uid, and public key from endpoint. We have to use a
-	// valid username to be given a login challenge.
+// Gatherer collects data from a device, it's a thin layer over an hnap.Client
+// that calls the actions needed for a Collection.
+type Gatherer struct {
+	credentials CredentialProvider
 
-	challenge := map[string]interface{}{
-		// Wrap the message in the HNAP action name.
-		"Login": map[string]string{
-			"Action":   "request",
-			"Username": g.username,
-		},
-	}
-	data, err := json.Marshal(challenge)
-	if err != nil {
-		return err
-	}
+	client     *hnap.Client
+	httpClient *http.Client
+}
 
-	req, err := http.NewRequest(http.MethodPost, g.endpoint.String(), bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-	req.Header.Add(hSOAPAction, loginURI)
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
+// Option configures optional behavior of a Gatherer.
+type Option func(*Gatherer) error
 
-	log.Debug("requesting challenge")
-	resp, err := g.client.Do(req)
-	if err != nil {
-		logrus.WithError(err).Error("unable to request challenge")
-		return err
-	}
-	log.Debug("accepting challenge")
-
-	hnapResponse := struct {
-		LoginResponse struct {
-			Challenge string
-			PublicKey string
-			// Should be held onto by the shared session.
-			Cookie string
+// WithTLS configures verification of the device's certificate.
+func WithTLS(opts TLSOptions) Option {
+	return func(g *Gatherer) error {
+		config, err := opts.Config()
+		if err != nil {
+			return err
 		}
-	}{}
-
-	err = json.NewDecoder(resp.Body).Decode(&hnapResponse)
-	if err != nil {
-		return err
-	}
-	log.WithFields(logrus.Fields{
-		"challenge": hnapResponse.LoginResponse.Challenge,
-		"uid":       hnapResponse.LoginResponse.Cookie,
-	}).Trace("computing response")
-
-	// 2. Compute challenge response by making its "private key". We'll use it
-	// to submit a login challenge response to complete the login-flow.
-
-	privateKey, err := digest(hnapResponse.LoginResponse.Challenge, []byte(hnapResponse.LoginResponse.PublicKey+g.password))
-	if err != nil {
-		return err
+		g.httpClient.Transport.(*http.Transport).TLSClientConfig = config
+		return nil
 	}
+}
 
-	passKey, err := digest(hnapResponse.LoginResponse.Challenge, privateKey)
-	if err != nil {
-		return err
+// WithCredentials configures the provider of the credentials used to login,
+// replacing the username and password given to New.
+func WithCredentials(provider CredentialProvider) Option {
+	return func(g *Gatherer) error {
+		g.credentials = provider
+		return nil
 	}
+}
 
-	uidCookie := &http.Cookie{
-		Name:  "uid",
-		Value: string(hnapResponse.LoginResponse.Cookie),
-	}
-	pkCookie := &http.Cookie{
-		Name:  "PrivateKey",
-		Value: string(privateKey),
+func New(endpoint *url.URL, username, password string, opts ...Option) (*Gatherer, error) {
+	httpClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+		Timeout: time.Second * 45,
 	}
 
-	// 3. Submit response to challenge to complete the login.
-
-	login := map[string]interface{}{
-		"Login": map[string]string{
-			"Action":        "login",
-			"Username":      g.username,
-			"LoginPassword": string(passKey),
+	g := &Gatherer{
+		credentials: StaticCredentials{
+			Username: username,
+			Password: password,
 		},
+		client:     hnap.NewClient(endpoint, httpClient),
+		httpClient: httpClient,
 	}
 
-	data, err = json.Marshal(login)
-	if err != nil {
-		return err
+	for _, opt := range opts {
+		err := opt(g)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	req, err = g.requestWithKey(loginAction, loginURI, bytes.NewReader(data), privateKey)
-	if err != nil {
-		return err
-	}
+	return g, nil
+}
 
-	req.AddCookie(uidCookie)
-	req.AddCookie(pkCookie)
+// Login starts a new login session with the device.
+func (g *Gatherer) Login() error {
+	return g.LoginContext(context.Background())
+}
 
-	log.Debug("submitting response")
-	resp, err = g.client.Do(req)
+// LoginContext starts a new login session with the device, the context is used
+// for each of the requests made.
+func (g *Gatherer) LoginContext(ctx context.Context) error {
+	creds, err := g.credentials.Credentials(ctx)
 	if err != nil {
-		log.WithError(err).Error("unable to login")
-		return err
+		return fmt.Errorf("unable to get credentials: %w", err)
 	}
-	resp.Body.Close()
 
-	log.WithFields(logrus.Fields{
-		"action":      loginURI,
-		"action.call": "login",
-		"status":      resp.StatusCode,
-	}).Debug("response sent")
-
-	if resp.StatusCode != http.StatusOK {
-		return errors.New("challenge response rejected")
-	}
+	return g.client.Login(ctx, creds.Username, creds.Password)
+}
 
-	// Update client to use our new session
+// LoggedIn reports whether the Gatherer holds a login session. The session may
+// have expired on the device, this is discovered once a call is made.
+func (g *Gatherer) LoggedIn() bool {
+	return g.client.LoggedIn()
+}
 
-	log.Trace("updating gatherer HTTP client")
-	// Acquire lock to modify the underlying client data.
-	g.mu.Lock()
-	{
-		// Record the Private Key that's for this login.
-		g.privateKey = privateKey
-		g.client.Jar.SetCookies(g.endpoint, []*http.Cookie{uidCookie, pkCookie})
-	}
-	g.mu.Unlock()
-	log.Trace("gatherer configured with new login session")
+// Close releases the idle connections held open to the device.
+func (g *Gatherer) Close() {
+	g.httpClient.CloseIdleConnections()
+}
 
-	return nil
+// Client is the hnap.Client used to call actions on the device.
+func (g *Gatherer) Client() *hnap.Client {
+	return g.client
 }
 
+// Gather collects data from the device using the current login session.
 func (g *Gatherer) Gather() (*Collection, error) {
-	const actionName = hnap.GetMultipleHNAPs
-	const actionURI = "http://purenetworks.com/HNAP1/" + actionName
-
-	log := logrus.WithField("action", actionURI)
+	return g.GatherContext(context.Background())
+}
 
-	data, err := json.Marshal(hnap.GetMultipleRequestData(
+// GatherContext collects data from the device using the current login session,
+// the context is used for the requests made.
+func (g *Gatherer) GatherContext(ctx context.Context) (*Collection, error) {
+	response, err := g.client.CallMultiple(ctx,
 		hnap.GetHomeAddress,
 		hnap.GetHomeConnection,
 		hnap.GetMotoLagStatus,
@@ -210,36 +156,17 @@ func (g *Gatherer) Gather() (*Collection, error) {
 		hnap.GetMotoStatusSoftware,
 		hnap.GetMotoStatusStartupSequence,
 		hnap.GetMotoStatusUpstreamChannelInfo,
-	))
-	if err != nil {
-		return nil, err
-	}
-
-	g.mu.RLock()
-	unlock := unlockGuarded(g.mu.RLocker())
-	defer unlock()
-
-	req, err := g.request(actionName, actionURI, bytes.NewReader(data))
-	if err != nil {
-		log.Error("unable to prepare request")
-		return nil, err
-	}
-	resp, err := g.client.Do(req)
+	)
 	if err != nil {
-		log.WithError(err).Error("unable to complete request")
-		return nil, err
+		return nil, wrapParseError(err)
 	}
-	unlock()
-
-	defer resp.Body.Close()
-
-	var response hnap.GetMultipleHNAPsResponse
 
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	if err != nil {
-		return nil, err
-	}
+	return ParseResponse(response)
+}
 
+// ParseResponse parses a Collection from the device's response to the
+// GetMultipleHNAPs call made by the Gatherer.
+func ParseResponse(response *hnap.GetMultipleHNAPsResponse) (*Collection, error) {
 	for k, v := range response.HNAP {
 		// Raw JSON string
 		logrus.WithField("name", k).Tracef("%s", v)
@@ -253,6 +180,8 @@ func (g *Gatherer) Gather() (*Collection, error) {
 		homeAddress    hnap.HomeAddressResponse
 		software       hnap.MotoStatusSoftwareResponse
 		connectionInfo hnap.MotoStatusConnectionInfoResponse
+		statusLog      hnap.MotoStatusLogResponse
+		lagStatus      hnap.MotoLagStatusResponse
 	)
 
 	parses := map[string]interface{}{
@@ -263,25 +192,54 @@ func (g *Gatherer) Gather() (*Collection, error) {
 		hnap.GetMotoStatusConnectionInfo:        &connectionInfo,
 		hnap.GetHomeConnection:                  &connection,
 		hnap.GetMotoStatusStartupSequence:       &startup,
+		hnap.GetMotoStatusLog:                   &statusLog,
+		hnap.GetMotoLagStatus:                   &lagStatus,
 	}
 
+	var unavailable []string
 	for name, binding := range parses {
-		data, err := response.GetJSON(name)
-		if err != nil {
-			return nil, fmt.Errorf("cannot fetch data: %w", err)
+		err := response.Decode(name, binding)
+		if err != nil && optionalAction(name) && !errors.Is(err, hnap.ErrUnauthorized) {
+			logrus.WithError(err).WithField("action", name).Debug("optional action unavailable")
+			unavailable = append(unavailable, name)
+			continue
 		}
-		err = json.Unmarshal(data, binding)
 		if err != nil {
-			return nil, fmt.Errorf("cannot parse data: %w", err)
+			return nil, wrapParseError(err)
 		}
 	}
+	sort.Strings(unavailable)
+
+	// Firmware doesn't always report an uptime, ie: before ranging completes,
+	// it's left out rather than failing the collection.
+	uptime, uptimeErr := connectionInfo.UptimeDuration()
+	if uptimeErr != nil {
+		logrus.WithError(uptimeErr).WithField("uptime", connectionInfo.Uptime).Warn("cannot parse uptime")
+	}
 
 	return &Collection{
 		Upstream:   upstream.Channels,
 		Downstream: downstream.Channels,
+		Log:        statusLog.Entries,
+
+		ParseErrors: append(append(downstream.ParseErrors, upstream.ParseErrors...), statusLog.ParseErrors...),
+		Unavailable: unavailable,
 
 		Online: connection.Online == hnap.Connected,
 
+		DeclaredDownstream: connection.DownstreamChannels,
+		DeclaredUpstream:   connection.UpstreamChannels,
+
+		Uptime:               uptime,
+		UptimeKnown:          uptimeErr == nil,
+		NetworkAccessAllowed: connectionInfo.NetworkAccessAllowed(),
+
+		LagAggregated: lagStatus.Aggregated(),
+
+		HWAddr: homeAddress.HWAddr,
+		IPv4:   homeAddress.IPv4,
+		IPv6:   homeAddress.IPv6,
+
 		SoftwareVersion: software.SoftwareVersion,
 		SpecVersion:     software.SpecVersion,
 		HardwareVersion: software.HardwareVersion,
@@ -289,56 +247,34 @@ func (g *Gatherer) Gather() (*Collection, error) {
 
 		CustomerVersion: software.CustomerVersion,
 		BootFile:        startup.ConfigurationFileName,
+
+		Startup: startup,
 	}, nil
 }
 
-func (g *Gatherer) request(actionName, actionURI string, data io.Reader) (*http.Request, error) {
-	return g.requestWithKey(actionName, actionURI, data, g.privateKey)
+// OptionalActions are the actions not supported by every model, ie: LAG on
+// models with a single ethernet port. Collections are made without them when
+// they're missing from the device's response or fail.
+var OptionalActions = []string{
+	hnap.GetMotoLagStatus,
+	hnap.GetMotoStatusLog,
 }
 
-func (g *Gatherer) requestWithKey(actionName, actionURI string, data io.Reader, key []byte) (*http.Request, error) {
-	req, err := http.NewRequest(http.MethodPost, g.endpoint.String(), data)
-	if err != nil {
-		return nil, err
-	}
-
-	hnapAuth, ts, err := digestAuth(actionURI, key)
-	if err != nil {
-		return nil, err
+func optionalAction(action string) bool {
+	for _, optional := range OptionalActions {
+		if action == optional {
+			return true
+		}
 	}
-
-	req.Header.Add(hSOAPAction, fmt.Sprintf(`"%s"`, actionURI))
-	req.Header.Add(hHNAPAuth, fmt.Sprintf("%s %d", string(hnapAuth), ts))
-
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	return req, nil
-}
-
-// Single use Unlock()er.
-func unlockGuarded(lock sync.Locker) func() {
-	var singleUse sync.Once
-	return func() { singleUse.Do(lock.Unlock) }
-}
-
-// digestAuth prepares an authentication digest for calling a given SOAPAction.
-func digestAuth(actionURI string, key []byte) ([]byte, int64, error) {
-	ts := time.Now().Unix()
-	data, err := digest(fmt.Sprintf(`%d"%s"`, ts, actionURI), key)
-	return data, ts, err
+	return false
 }
 
-// digest prepares an authentication digest for use with HNAP.
-func digest(msg string, key []byte) ([]byte, error) {
-	mac := hmac.New(md5.New, key)
-	_, err := fmt.Fprint(mac, msg)
-	if err != nil {
-		return nil, err
+// wrapParseError wraps errors for malformed responses in a ParseError, other
+// errors are returned as is.
+func wrapParseError(err error) error {
+	var decodeErr *hnap.DecodeError
+	if errors.As(err, &decodeErr) || errors.Is(err, hnap.ErrMissingAction) {
+		return &ParseError{Err: err}
 	}
-	digestData := mac.Sum(nil)
-
-	digestHex := make([]byte, hex.EncodedLen(len(digestData)))
-	hex.Encode(digestHex, digestData)
-	return bytes.ToUpper(digestHex), nil
+	return err
 }
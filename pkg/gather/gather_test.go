@@ -0,0 +1,130 @@
+package gather
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap/hnaptest"
+)
+
+func newTestGatherer(t *testing.T) (*hnaptest.Server, *Gatherer) {
+	modem := hnaptest.NewServer()
+	t.Cleanup(modem.Close)
+
+	g, err := New(modem.Endpoint(), hnaptest.DefaultUsername, hnaptest.DefaultPassword)
+	require.NoError(t, err)
+
+	return modem, g
+}
+
+func TestGatherer(t *testing.T) {
+	modem, g := newTestGatherer(t)
+
+	require.NoError(t, g.Login())
+	assert.True(t, g.LoggedIn())
+	assert.Equal(t, 1, modem.Logins())
+
+	collection, err := g.Gather()
+	require.NoError(t, err)
+
+	assert.True(t, collection.Online)
+	assert.Len(t, collection.Downstream, 33)
+	assert.Len(t, collection.Upstream, 4)
+	assert.Len(t, collection.Log, 2)
+	assert.Equal(t, int64(33), collection.DeclaredDownstream)
+	assert.Equal(t, 4*24*time.Hour+8*time.Hour+57*time.Minute+40*time.Second, collection.Uptime)
+	assert.True(t, collection.UptimeKnown)
+	assert.True(t, collection.NetworkAccessAllowed)
+	assert.Equal(t, net.ParseIP("192.0.2.10"), collection.IPv4)
+	assert.Equal(t, "8600-19.3.18", collection.SoftwareVersion)
+	assert.Equal(t, "d11_m_mb8600_gigabit_c01.cm", collection.BootFile)
+}
+
+func TestGathererLoginRejected(t *testing.T) {
+	modem, g := newTestGatherer(t)
+	modem.SetCredentials(hnaptest.DefaultUsername, "changed")
+
+	assert.ErrorIs(t, g.Login(), ErrLoginRejected)
+	assert.False(t, g.LoggedIn())
+}
+
+func TestGathererSessionExpired(t *testing.T) {
+	modem, g := newTestGatherer(t)
+	require.NoError(t, g.Login())
+
+	modem.ExpireSessions()
+	_, err := g.Gather()
+	assert.ErrorIs(t, err, ErrSessionExpired)
+	assert.False(t, g.LoggedIn())
+
+	require.NoError(t, g.Login())
+	_, err = g.Gather()
+	assert.NoError(t, err)
+}
+
+func TestGathererMalformedTable(t *testing.T) {
+	modem, g := newTestGatherer(t)
+	require.NoError(t, g.Login())
+
+	modem.SetField(hnap.GetMotoStatusDownstreamChannelInfo, "MotoConnDownstreamChannel", "1^Locked^QAM256^33^663.0^-9.3^38.8^42325^10482^|+|garbage")
+	collection, err := g.Gather()
+	require.NoError(t, err, "malformed rows are left out")
+	assert.Len(t, collection.Downstream, 1)
+	require.Len(t, collection.ParseErrors, 1)
+	assert.Equal(t, hnap.TableDownstream, collection.ParseErrors[0].Table)
+
+	modem.RemoveAction(hnap.GetMotoStatusDownstreamChannelInfo)
+	_, err = g.Gather()
+	var parseErr *ParseError
+	assert.ErrorAs(t, err, &parseErr)
+}
+
+func TestGathererUnknownUptime(t *testing.T) {
+	modem, g := newTestGatherer(t)
+	require.NoError(t, g.Login())
+
+	modem.SetField(hnap.GetMotoStatusConnectionInfo, "MotoConnSystemUpTime", "")
+	collection, err := g.Gather()
+	require.NoError(t, err, "the uptime alone is left out")
+	assert.False(t, collection.UptimeKnown)
+	assert.Zero(t, collection.Uptime)
+	assert.Len(t, collection.Downstream, 33)
+}
+
+func TestGathererActionFailed(t *testing.T) {
+	modem, g := newTestGatherer(t)
+	require.NoError(t, g.Login())
+
+	modem.SetField(hnap.GetMotoLagStatus, hnap.GetMotoLagStatus+"Result", "ERROR")
+	modem.RemoveAction(hnap.GetMotoStatusLog)
+	collection, err := g.Gather()
+	require.NoError(t, err, "optional actions are left out")
+	assert.Equal(t, []string{hnap.GetMotoLagStatus, hnap.GetMotoStatusLog}, collection.Unavailable)
+	assert.False(t, collection.Available(hnap.GetMotoLagStatus))
+	assert.Empty(t, collection.Log)
+	assert.Len(t, collection.Downstream, 33)
+
+	modem.SetField(hnap.GetMotoStatusSoftware, hnap.GetMotoStatusSoftware+"Result", "ERROR")
+	_, err = g.Gather()
+	var failed *hnap.ErrActionFailed
+	require.ErrorAs(t, err, &failed)
+	assert.Equal(t, hnap.GetMotoStatusSoftware, failed.Action)
+}
+
+func TestGathererSlowResponse(t *testing.T) {
+	modem, g := newTestGatherer(t)
+	require.NoError(t, g.Login())
+
+	modem.SetDelay(250 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := g.GatherContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
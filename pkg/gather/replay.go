@@ -0,0 +1,114 @@
+package gather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
+)
+
+// Replay gathers Collections from recorded GetMultipleHNAPs responses in place
+// of a device. The recordings are parsed just as the device's responses are,
+// so optional actions that failed when recorded are left out.
+type Replay struct {
+	paths []string
+	now   func() time.Time
+
+	mu   sync.Mutex
+	next int
+	// repeating is when the last recording was first replayed.
+	repeating time.Time
+}
+
+// NewReplay prepares a Replay of the recording at path. The path is either a
+// single recording, replayed on each gather, or a directory of recordings
+// (*.json) replayed in the order of their names, ie: timestamped names. Once
+// each has been replayed, the last recording is repeated.
+//
+// Recordings are replayed one per gather, not at the spacing they were
+// recorded with. The uptime of a repeated recording is advanced by the time
+// since it was first replayed, as the device's would be, so its boot time
+// holds steady.
+func NewReplay(path string) (*Replay, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{path}
+	if info.IsDir() {
+		paths, err = filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no recordings found in %s", path)
+		}
+		sort.Strings(paths)
+	}
+
+	return &Replay{
+		paths: paths,
+		now:   time.Now,
+	}, nil
+}
+
+// LoginContext implements the Gatherer's login, no login is needed to replay.
+func (r *Replay) LoginContext(ctx context.Context) error {
+	return nil
+}
+
+// LoggedIn reports that the Replay is always ready to gather.
+func (r *Replay) LoggedIn() bool {
+	return true
+}
+
+// Gather collects data from the next recording.
+func (r *Replay) Gather() (*Collection, error) {
+	return r.GatherContext(context.Background())
+}
+
+// GatherContext collects data from the next recording.
+func (r *Replay) GatherContext(ctx context.Context) (*Collection, error) {
+	r.mu.Lock()
+	path := r.paths[r.next]
+	var elapsed time.Duration
+	if r.next < len(r.paths)-1 {
+		r.next++
+	} else if r.repeating.IsZero() {
+		r.repeating = r.now()
+	} else {
+		elapsed = r.now().Sub(r.repeating)
+	}
+	r.mu.Unlock()
+
+	logrus.WithField("recording", path).Debug("replaying recording")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var response hnap.GetMultipleHNAPsResponse
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		return nil, &ParseError{Err: fmt.Errorf("%s: %w", path, err)}
+	}
+
+	collection, err := ParseResponse(&response)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if collection.UptimeKnown {
+		collection.Uptime += elapsed
+	}
+	return collection, nil
+}
@@ -0,0 +1,57 @@
+package gather
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap/hnaptest"
+)
+
+func TestReplayDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for name, uptime := range map[string]string{
+		"2021-03-02T02:00:00Z.json": "0 days 00h:00m:10s",
+		"2021-03-02T02:00:30Z.json": "0 days 00h:00m:40s",
+	} {
+		data := bytes.Replace(hnaptest.DefaultFixture, []byte("4 days 08h:57m:40s"), []byte(uptime), 1)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644))
+
+	replay, err := NewReplay(dir)
+	require.NoError(t, err)
+	now := time.Date(2021, 3, 2, 3, 0, 0, 0, time.UTC)
+	replay.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	// Recordings are replayed in order, repeating the last with its uptime
+	// advanced by the time since it was first replayed.
+	for _, expected := range []time.Duration{10 * time.Second, 40 * time.Second, 100 * time.Second, 160 * time.Second} {
+		collection, err := replay.Gather()
+		require.NoError(t, err)
+		assert.Equal(t, expected, collection.Uptime)
+	}
+}
+
+func TestReplayMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+
+	replay, err := NewReplay(path)
+	require.NoError(t, err)
+
+	_, err = replay.Gather()
+	var parseErr *ParseError
+	assert.ErrorAs(t, err, &parseErr)
+
+	_, err = NewReplay(t.TempDir())
+	assert.Error(t, err, "directories without recordings are rejected")
+}
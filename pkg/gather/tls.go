@@ -0,0 +1,194 @@
+package gather
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrFingerprintMismatch is returned when the device presents a certificate
+// other than the one it's pinned to.
+var ErrFingerprintMismatch = errors.New("certificate fingerprint mismatch")
+
+// TLSOptions configures verification of the device's certificate. Devices use
+// self-signed certificates, so without any options set the certificate is not
+// verified at all.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of certificates that the device's certificate
+	// must chain to. The certificate's names are not checked, devices rarely
+	// carry their address as one.
+	CAFile string
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the device's
+	// certificate to pin to.
+	Fingerprint string
+	// TrustOnFirstUseFile is where the fingerprint of the device's first seen
+	// certificate is recorded, the device's certificate is then pinned to it.
+	TrustOnFirstUseFile string
+}
+
+// Config prepares the TLS configuration for connecting to the device.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	verifier := &certVerifier{
+		tofuFile: o.TrustOnFirstUseFile,
+	}
+
+	if o.CAFile != "" {
+		data, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		verifier.roots = x509.NewCertPool()
+		if !verifier.roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA file %q", o.CAFile)
+		}
+	}
+
+	if o.Fingerprint != "" {
+		fingerprint, err := ParseFingerprint(o.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		verifier.pinned = fingerprint
+	}
+
+	if o.TrustOnFirstUseFile != "" && verifier.pinned == nil {
+		data, err := os.ReadFile(o.TrustOnFirstUseFile)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// Recorded on first use.
+		case err != nil:
+			return nil, fmt.Errorf("read trusted fingerprint: %w", err)
+		default:
+			fingerprint, err := ParseFingerprint(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("trusted fingerprint file %q: %w", o.TrustOnFirstUseFile, err)
+			}
+			verifier.pinned = fingerprint
+		}
+	}
+
+	return &tls.Config{
+		// Verification is handled by the verifier, the standard verification
+		// requires the device's address be in its certificate.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifier.verify,
+	}, nil
+}
+
+// ParseFingerprint parses a hex encoded SHA-256 fingerprint, the bytes may be
+// separated by colons as commonly printed by tools.
+func ParseFingerprint(s string) ([]byte, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ":", "")
+	fingerprint, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse fingerprint: %w", err)
+	}
+	if len(fingerprint) != sha256.Size {
+		return nil, fmt.Errorf("parse fingerprint: expected %d bytes but found %d", sha256.Size, len(fingerprint))
+	}
+	return fingerprint, nil
+}
+
+// Fingerprint formats the SHA-256 fingerprint of the certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// certVerifier verifies the certificate presented by the device.
+type certVerifier struct {
+	roots    *x509.CertPool
+	tofuFile string
+
+	mu     sync.Mutex
+	pinned []byte
+}
+
+func (v *certVerifier) verify(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no certificate presented")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parse certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+	leaf := certs[0]
+
+	if v.roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         v.roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	sum := sha256.Sum256(leaf.Raw)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.pinned == nil {
+		if v.tofuFile == "" {
+			return nil
+		}
+		// First use, trust and record the presented certificate.
+		fingerprint := hex.EncodeToString(sum[:])
+		err := writeFileAtomic(v.tofuFile, []byte(fingerprint+"\n"))
+		if err != nil {
+			return fmt.Errorf("record trusted fingerprint: %w", err)
+		}
+		logrus.WithFields(logrus.Fields{
+			"fingerprint": fingerprint,
+			"file":        v.tofuFile,
+		}).Info("trusting device certificate on first use")
+		v.pinned = sum[:]
+		return nil
+	}
+
+	if !bytes.Equal(v.pinned, sum[:]) {
+		return fmt.Errorf("%w: expected %x but device presented %x", ErrFingerprintMismatch, v.pinned, sum[:])
+	}
+
+	return nil
+}
+
+// writeFileAtomic replaces the file's content with the data, readers see
+// either the previous content or the data in full.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,67 @@
+package gather
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tlsGet(t *testing.T, opts TLSOptions, url string) error {
+	config, err := opts.Config()
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	resp, err := client.Get(url)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestTLSOptionsFingerprint(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	other := httptest.NewTLSServer(http.NotFoundHandler())
+	defer other.Close()
+
+	fingerprint := Fingerprint(srv.Certificate())
+
+	assert.NoError(t, tlsGet(t, TLSOptions{Fingerprint: fingerprint}, srv.URL))
+
+	// The httptest servers share a certificate, pin to a different one.
+	mismatched := strings.Repeat("00", 32)
+	err := tlsGet(t, TLSOptions{Fingerprint: mismatched}, other.URL)
+	assert.ErrorIs(t, err, ErrFingerprintMismatch)
+}
+
+func TestTLSOptionsTrustOnFirstUse(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "fingerprint")
+	opts := TLSOptions{TrustOnFirstUseFile: file}
+
+	require.NoError(t, tlsGet(t, opts, srv.URL))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, Fingerprint(srv.Certificate()), strings.TrimSpace(string(data)))
+
+	// Subsequent uses are pinned to the recorded fingerprint.
+	require.NoError(t, tlsGet(t, opts, srv.URL))
+
+	require.NoError(t, os.WriteFile(file, []byte(strings.Repeat("ab", 32)), 0o600))
+	err = tlsGet(t, opts, srv.URL)
+	assert.ErrorIs(t, err, ErrFingerprintMismatch)
+}
+
+func TestParseFingerprint(t *testing.T) {
+	_, err := ParseFingerprint(strings.Repeat("AB:", 31) + "AB")
+	assert.NoError(t, err)
+	_, err = ParseFingerprint("abcd")
+	assert.Error(t, err)
+}
@@ -17,6 +17,20 @@ const (
 	GetMotoStatusUpstreamChannelInfo   = "GetMotoStatusUpstreamChannelInfo"
 )
 
+// KnownActions are the confirmed actions that may be called through
+// GetMultipleHNAPs.
+var KnownActions = []string{
+	GetHomeAddress,
+	GetHomeConnection,
+	GetMotoLagStatus,
+	GetMotoStatusConnectionInfo,
+	GetMotoStatusDownstreamChannelInfo,
+	GetMotoStatusLog,
+	GetMotoStatusSoftware,
+	GetMotoStatusStartupSequence,
+	GetMotoStatusUpstreamChannelInfo,
+}
+
 // {
 //     "GetMultipleHNAPsResponse": {
 //         "GetMotoStatusStartupSequenceResponse": {
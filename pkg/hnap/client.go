@@ -0,0 +1,327 @@
+package hnap
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Namespace is the namespace of HNAP actions, an action's SOAPAction is its
+// name in the namespace.
+const Namespace = "http://purenetworks.com/HNAP1/"
+
+// Login is the action used to start a login session.
+const Login = "Login"
+
+const hSOAPAction = "SOAPAction"
+const hHNAPAuth = "HNAP_AUTH"
+
+// Client calls HNAP actions on a device.
+type Client struct {
+	endpoint *url.URL
+	client   *http.Client
+
+	mu      sync.RWMutex
+	session *session
+}
+
+// session is a login session established with the device.
+type session struct {
+	uid        string
+	privateKey []byte
+}
+
+// NewClient prepares a Client for the device's HNAP endpoint, ie:
+// https://192.168.100.1/HNAP1/. The HTTP client is used for all requests made,
+// http.DefaultClient is used when nil.
+func NewClient(endpoint *url.URL, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Client{
+		endpoint: endpoint,
+		client:   client,
+	}
+}
+
+// Login starts a new login session with the device, replacing any existing
+// session.
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	log := logrus.WithField("action", "login")
+
+	// 1. Request challenge, uid, and public key from endpoint. We have to use a
+	// valid username to be given a login challenge.
+
+	var challenge struct {
+		Challenge string
+		PublicKey string
+		// Should be held onto by the shared session.
+		Cookie string
+	}
+
+	log.Debug("requesting challenge")
+	err := c.call(ctx, nil, Login, map[string]string{
+		"Action":   "request",
+		"Username": username,
+	}, &challenge)
+	if err != nil {
+		log.WithError(err).Error("unable to request challenge")
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"challenge": challenge.Challenge,
+		"uid":       challenge.Cookie,
+	}).Trace("computing response")
+
+	// 2. Compute challenge response by making its "private key". We'll use it
+	// to submit a login challenge response to complete the login-flow.
+
+	privateKey, err := digest(challenge.Challenge, []byte(challenge.PublicKey+password))
+	if err != nil {
+		return err
+	}
+
+	passKey, err := digest(challenge.Challenge, privateKey)
+	if err != nil {
+		return err
+	}
+
+	s := &session{
+		uid:        challenge.Cookie,
+		privateKey: privateKey,
+	}
+
+	// 3. Submit response to challenge to complete the login.
+
+	log.Debug("submitting response")
+	err = c.call(ctx, s, Login, map[string]string{
+		"Action":        "login",
+		"Username":      username,
+		"LoginPassword": string(passKey),
+	}, nil)
+	var (
+		statusErr *StatusError
+		failedErr *ErrActionFailed
+	)
+	switch {
+	case errors.As(err, &statusErr), errors.As(err, &failedErr), errors.Is(err, ErrUnauthorized):
+		log.WithError(err).Debug("response rejected")
+		return ErrLoginRejected
+	case err != nil:
+		log.WithError(err).Error("unable to login")
+		return err
+	}
+
+	c.mu.Lock()
+	c.session = s
+	c.mu.Unlock()
+	log.Trace("client configured with new login session")
+
+	return nil
+}
+
+// LoggedIn reports whether the Client holds a login session. The session may
+// have expired on the device, this is discovered once a call is made.
+func (c *Client) LoggedIn() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.session != nil
+}
+
+// Call calls the action on the device with the request, decoding the action's
+// response into resp. The action's result is checked, calls that the device
+// reports as unsuccessful return an ErrActionFailed, or ErrUnauthorized when
+// the login session isn't accepted.
+func (c *Client) Call(ctx context.Context, action string, req, resp interface{}) error {
+	c.mu.RLock()
+	s := c.session
+	c.mu.RUnlock()
+
+	err := c.call(ctx, s, action, req, resp)
+	if errors.Is(err, ErrUnauthorized) {
+		c.expire(s)
+	}
+	return err
+}
+
+// CallMultiple calls each of the actions on the device in a single
+// GetMultipleHNAPs call. The results of the individual actions are left to the
+// caller to check as each is decoded, a failed action doesn't fail the call
+// unless the device reports the login session is no longer authorized.
+func (c *Client) CallMultiple(ctx context.Context, actions ...string) (*GetMultipleHNAPsResponse, error) {
+	req := map[string]string{}
+	for _, action := range actions {
+		req[action] = ""
+	}
+
+	c.mu.RLock()
+	s := c.session
+	c.mu.RUnlock()
+
+	var resp GetMultipleHNAPsResponse
+	err := c.call(ctx, s, GetMultipleHNAPs, req, &resp.HNAP)
+	for _, action := range actions {
+		if err != nil {
+			break
+		}
+		data, missing := resp.GetJSON(action)
+		if errors.Is(missing, ErrMissingAction) {
+			continue
+		}
+		if result := checkResult(action, data); errors.Is(result, ErrUnauthorized) {
+			err = result
+		}
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		c.expire(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// expire drops the login session, unless it was already replaced.
+func (c *Client) expire(s *session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session == s {
+		c.session = nil
+	}
+}
+
+// call makes a call with the login session, the call is unauthenticated
+// without one.
+func (c *Client) call(ctx context.Context, s *session, action string, req, resp interface{}) error {
+	actionURI := Namespace + action
+
+	log := logrus.WithField("action", actionURI)
+
+	data, err := json.Marshal(map[string]interface{}{
+		// Wrap the message in the HNAP action name.
+		action: req,
+	})
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Add(hSOAPAction, fmt.Sprintf(`"%s"`, actionURI))
+	httpReq.Header.Add("Content-Type", "application/json")
+	httpReq.Header.Add("Accept", "application/json")
+
+	if s != nil {
+		hnapAuth, ts, err := digestAuth(actionURI, s.privateKey)
+		if err != nil {
+			return err
+		}
+		httpReq.Header.Add(hHNAPAuth, fmt.Sprintf("%s %d", string(hnapAuth), ts))
+		httpReq.AddCookie(&http.Cookie{Name: "uid", Value: s.uid})
+		httpReq.AddCookie(&http.Cookie{Name: "PrivateKey", Value: string(s.privateKey)})
+	}
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		log.WithError(err).Error("unable to complete request")
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	log.WithField("status", httpResp.StatusCode).Debug("response received")
+
+	switch {
+	case httpResp.StatusCode == http.StatusUnauthorized,
+		httpResp.StatusCode == http.StatusForbidden,
+		httpResp.StatusCode >= 300 && httpResp.StatusCode < 400:
+		// The device sends the client back to its login page.
+		return ErrUnauthorized
+	case httpResp.StatusCode != http.StatusOK:
+		return &StatusError{StatusCode: httpResp.StatusCode, Status: httpResp.Status}
+	}
+
+	var body map[string]json.RawMessage
+	err = json.NewDecoder(httpResp.Body).Decode(&body)
+	if err != nil {
+		return &DecodeError{Action: action, Err: err}
+	}
+	data, ok := body[action+"Response"]
+	if !ok {
+		return fmt.Errorf("%s: %w", action, ErrMissingAction)
+	}
+
+	err = checkResult(action, data)
+	if err != nil {
+		return err
+	}
+
+	if resp == nil {
+		return nil
+	}
+	err = json.Unmarshal(data, resp)
+	if err != nil {
+		return &DecodeError{Action: action, Err: err}
+	}
+	return nil
+}
+
+// checkResult checks the result reported in the action's response, ie:
+// GetMotoLagStatusResult.
+func checkResult(action string, data json.RawMessage) error {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return &DecodeError{Action: action, Err: err}
+	}
+	var result string
+	// Absent or malformed results are reported as empty.
+	_ = json.Unmarshal(fields[action+"Result"], &result)
+
+	switch result {
+	case OK, "":
+		// Not all devices report a result.
+		return nil
+	case Unauthorized:
+		return ErrUnauthorized
+	default:
+		return &ErrActionFailed{Action: action, Result: result}
+	}
+}
+
+// digestAuth prepares an authentication digest for calling a given SOAPAction.
+func digestAuth(actionURI string, key []byte) ([]byte, int64, error) {
+	ts := time.Now().Unix()
+	data, err := digest(fmt.Sprintf(`%d"%s"`, ts, actionURI), key)
+	return data, ts, err
+}
+
+// digest prepares an authentication digest for use with HNAP.
+func digest(msg string, key []byte) ([]byte, error) {
+	mac := hmac.New(md5.New, key)
+	_, err := fmt.Fprint(mac, msg)
+	if err != nil {
+		return nil, err
+	}
+	digestData := mac.Sum(nil)
+
+	digestHex := make([]byte, hex.EncodedLen(len(digestData)))
+	hex.Encode(digestHex, digestData)
+	return bytes.ToUpper(digestHex), nil
+}
@@ -0,0 +1,80 @@
+package hnap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCall(t *testing.T) {
+	const challenge, publicKey, password = "challenge", "public", "password"
+
+	privateKey, err := digest(challenge, []byte(publicKey+password))
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		soapAction := r.Header.Get(hSOAPAction)
+		assert.True(t, strings.HasPrefix(soapAction, `"`+Namespace), soapAction)
+		action := strings.TrimSuffix(strings.TrimPrefix(soapAction, `"`+Namespace), `"`)
+
+		var body struct {
+			Login struct{ Action string }
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		if body.Login.Action == "request" {
+			fmt.Fprintf(w, `{"LoginResponse": {"Challenge": %q, "PublicKey": %q, "Cookie": "uid", "LoginResult": "OK"}}`, challenge, publicKey)
+			return
+		}
+
+		var ts int64
+		var auth string
+		fmt.Sscanf(r.Header.Get(hHNAPAuth), "%s %d", &auth, &ts)
+		expected, _ := digest(fmt.Sprintf(`%d"%s"`, ts, Namespace+action), privateKey)
+		if auth == "" || auth != string(expected) {
+			fmt.Fprintf(w, `{%q: {%q: "UN-AUTH"}}`, action+"Response", action+"Result")
+			return
+		}
+
+		switch action {
+		case Login:
+			fmt.Fprint(w, `{"LoginResponse": {"LoginResult": "OK"}}`)
+		case GetMotoLagStatus:
+			fmt.Fprint(w, `{"GetMotoLagStatusResponse": {"MotoLagCurrentStatus": "1", "GetMotoLagStatusResult": "OK"}}`)
+		default:
+			fmt.Fprintf(w, `{%q: {%q: "ERROR"}}`, action+"Response", action+"Result")
+		}
+	}))
+	defer srv.Close()
+
+	endpoint, err := url.Parse(srv.URL + "/HNAP1/")
+	require.NoError(t, err)
+	client := NewClient(endpoint, srv.Client())
+	ctx := context.Background()
+
+	err = client.Call(ctx, GetMotoLagStatus, "", nil)
+	assert.ErrorIs(t, err, ErrUnauthorized, "calls without a session are unauthorized")
+
+	require.NoError(t, client.Login(ctx, "admin", password))
+	assert.True(t, client.LoggedIn())
+
+	var lag MotoLagStatusResponse
+	require.NoError(t, client.Call(ctx, GetMotoLagStatus, "", &lag))
+	assert.True(t, lag.Aggregated())
+
+	err = client.Call(ctx, GetMotoStatusLog, "", nil)
+	var failed *ErrActionFailed
+	require.ErrorAs(t, err, &failed)
+	assert.Equal(t, ErrActionFailed{Action: GetMotoStatusLog, Result: "ERROR"}, *failed)
+
+	assert.ErrorIs(t, client.Login(ctx, "admin", "incorrect"), ErrLoginRejected)
+	assert.True(t, client.LoggedIn(), "rejected login keeps the existing session")
+}
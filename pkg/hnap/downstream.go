@@ -103,6 +103,10 @@ func (info *DownstreamInfo) Parse(row []string) error {
 
 type DownstreamChannelResponse struct {
 	Channels []DownstreamInfo
+
+	// ParseErrors are the rows that could not be parsed, these are left out
+	// of Channels.
+	ParseErrors []RowError
 }
 
 func (r *DownstreamChannelResponse) UnmarshalJSON(data []byte) error {
@@ -116,16 +120,21 @@ func (r *DownstreamChannelResponse) UnmarshalJSON(data []byte) error {
 	}
 
 	tbl := plustable.Parse(innerType.MotoConnDownstreamChannel)
-	info := make([]DownstreamInfo, len(tbl))
-	for i, row := range tbl {
-		err = info[i].Parse(row)
+	info := make([]DownstreamInfo, 0, len(tbl))
+	var parseErrors []RowError
+	for _, row := range tbl {
+		var channel DownstreamInfo
+		err = channel.Parse(row)
 		if err != nil {
-			logrus.WithError(err).WithField("row", row).Error("could not parse data")
-			return err
+			logrus.WithError(err).WithField("row", row).Debug("could not parse data")
+			parseErrors = append(parseErrors, RowError{Table: TableDownstream, Row: row, Err: err})
+			continue
 		}
+		info = append(info, channel)
 	}
 
 	r.Channels = info
+	r.ParseErrors = parseErrors
 
 	return nil
 }
@@ -0,0 +1,55 @@
+package hnap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnauthorized is returned when the device doesn't accept the login session
+// used for a call, ie: it expired. The Client must Login again.
+var ErrUnauthorized = errors.New("login session not authorized")
+
+// ErrLoginRejected is returned when the device rejects the login, ie: the
+// credentials are incorrect.
+var ErrLoginRejected = errors.New("challenge response rejected")
+
+// ErrMissingAction is returned when the device's response doesn't include the
+// called action's response.
+var ErrMissingAction = errors.New("no response for action")
+
+// ErrActionFailed is returned when the device reports an unsuccessful result
+// for an action.
+type ErrActionFailed struct {
+	Action string
+	Result string
+}
+
+func (e *ErrActionFailed) Error() string {
+	return fmt.Sprintf("%s: unexpected result: %q", e.Action, e.Result)
+}
+
+// StatusError is returned when the device responds with an unexpected HTTP
+// status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.Status)
+}
+
+// DecodeError is returned when the device's response to an action could not
+// be decoded.
+type DecodeError struct {
+	Action string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cannot decode %s response: %v", e.Action, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,373 @@
+// Package hnaptest provides a fake HNAP device for testing clients without a
+// real modem.
+package hnaptest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	_ "embed"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/hnap"
+)
+
+// DefaultFixture is a GetMultipleHNAPs response from an MB8600 that answers
+// each of the known actions. The channel tables, startup sequence, connection
+// info and LAG status are recorded from the device, the remaining actions are
+// answered with placeholders.
+//
+//go:embed fixtures/mb8600.json
+var DefaultFixture []byte
+
+// Default credentials accepted by a Server.
+const (
+	DefaultUsername = "admin"
+	DefaultPassword = "motorola"
+)
+
+// Server is a fake device serving the HNAP endpoint at /HNAP1/. It implements
+// the Login challenge and response, verifies the HNAP_AUTH of each call made
+// with a login session and answers actions from its fixture.
+type Server struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// username and password are the accepted credentials.
+	username string
+	password string
+	// responses are the responses to actions, by action.
+	responses map[string]map[string]interface{}
+	// challenges are the challenges given to logins in progress, by uid.
+	challenges map[string]challenge
+	// sessions are the private keys of login sessions, by uid.
+	sessions map[string][]byte
+	delay    time.Duration
+	logins   int
+	calls    map[string]int
+}
+
+type challenge struct {
+	username  string
+	challenge string
+	publicKey string
+}
+
+// NewServer starts a Server answering with the DefaultFixture, it accepts the
+// default credentials. The caller should Close the Server when finished.
+func NewServer() *Server {
+	s := &Server{
+		username:   DefaultUsername,
+		password:   DefaultPassword,
+		challenges: map[string]challenge{},
+		sessions:   map[string][]byte{},
+		calls:      map[string]int{},
+	}
+	if err := s.LoadFixture(DefaultFixture); err != nil {
+		panic(fmt.Sprintf("hnaptest: default fixture: %v", err))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/HNAP1/", s.serveHNAP)
+	s.Server = httptest.NewTLSServer(mux)
+
+	return s
+}
+
+// Endpoint is the URL of the Server's HNAP endpoint.
+func (s *Server) Endpoint() *url.URL {
+	u, _ := url.Parse(s.URL + "/HNAP1/")
+	return u
+}
+
+// SetCredentials configures the credentials accepted by the Server.
+func (s *Server) SetCredentials(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.username = username
+	s.password = password
+}
+
+// LoadFixture replaces the Server's responses with those of a GetMultipleHNAPs
+// response.
+func (s *Server) LoadFixture(data []byte) error {
+	var fixture struct {
+		Responses map[string]json.RawMessage `json:"GetMultipleHNAPsResponse"`
+	}
+	err := json.Unmarshal(data, &fixture)
+	if err != nil {
+		return err
+	}
+
+	responses := map[string]map[string]interface{}{}
+	for name, data := range fixture.Responses {
+		action := strings.TrimSuffix(name, "Response")
+		if action == name {
+			// Not a response, ie: GetMultipleHNAPsResult.
+			continue
+		}
+		var response map[string]interface{}
+		err := json.Unmarshal(data, &response)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		responses[action] = response
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = responses
+
+	return nil
+}
+
+// SetField sets a field in the action's response, ie: to answer with a
+// malformed table or an unsuccessful result.
+func (s *Server) SetField(action, field string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response, ok := s.responses[action]
+	if !ok {
+		response = map[string]interface{}{}
+		s.responses[action] = response
+	}
+	response[field] = value
+}
+
+// RemoveAction removes the action's response, as devices that don't support
+// the action do.
+func (s *Server) RemoveAction(action string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.responses, action)
+}
+
+// ExpireSessions expires every login session, calls made with them are
+// answered as unauthorized.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = map[string][]byte{}
+}
+
+// SetDelay delays each response by the duration.
+func (s *Server) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delay = delay
+}
+
+// Logins is the number of successful logins made.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logins
+}
+
+// Calls is the number of authorized calls made to the action.
+func (s *Server) Calls(action string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[action]
+}
+
+func (s *Server) serveHNAP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delay := s.delay
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	soapAction := r.Header.Get("SOAPAction")
+	actionURI := strings.Trim(soapAction, `"`)
+	action := strings.TrimPrefix(actionURI, hnap.Namespace)
+	if soapAction != `"`+actionURI+`"` || action == actionURI {
+		http.Error(w, fmt.Sprintf("invalid SOAPAction: %q", soapAction), http.StatusBadRequest)
+		return
+	}
+
+	var body map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, ok := body[action]
+	if !ok {
+		http.Error(w, fmt.Sprintf("missing %s request", action), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if action == hnap.Login {
+		s.login(w, r, req)
+		return
+	}
+
+	if !s.authorized(r, actionURI) {
+		writeResponse(w, action, map[string]interface{}{
+			action + "Result": hnap.Unauthorized,
+		})
+		return
+	}
+	s.calls[action]++
+
+	if action != hnap.GetMultipleHNAPs {
+		response, ok := s.responses[action]
+		if !ok {
+			response = map[string]interface{}{action + "Result": "ERROR"}
+		}
+		writeResponse(w, action, response)
+		return
+	}
+
+	var actions map[string]string
+	err = json.Unmarshal(req, &actions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	responses := map[string]interface{}{
+		hnap.GetMultipleHNAPs + "Result": hnap.OK,
+	}
+	for name := range actions {
+		if response, ok := s.responses[name]; ok {
+			responses[name+"Response"] = response
+		}
+	}
+	writeResponse(w, action, responses)
+}
+
+// login handles both the challenge request and response of the Login action.
+func (s *Server) login(w http.ResponseWriter, r *http.Request, data json.RawMessage) {
+	var req struct {
+		Action        string
+		Username      string
+		LoginPassword string
+	}
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch req.Action {
+	case "request":
+		c := challenge{
+			username:  req.Username,
+			challenge: randomString(),
+			publicKey: randomString(),
+		}
+		uid := randomString()
+		s.challenges[uid] = c
+		writeResponse(w, hnap.Login, map[string]interface{}{
+			"Challenge":   c.challenge,
+			"PublicKey":   c.publicKey,
+			"Cookie":      uid,
+			"LoginResult": hnap.OK,
+		})
+	case "login":
+		uid, _ := r.Cookie("uid")
+		if uid == nil {
+			writeResponse(w, hnap.Login, map[string]interface{}{"LoginResult": "FAILED"})
+			return
+		}
+		c, ok := s.challenges[uid.Value]
+		delete(s.challenges, uid.Value)
+
+		privateKey := digest(c.challenge, []byte(c.publicKey+s.password))
+		passKey := digest(c.challenge, privateKey)
+
+		if !ok || c.username != s.username || req.Username != s.username ||
+			req.LoginPassword != string(passKey) ||
+			!s.validAuth(r, hnap.Namespace+hnap.Login, privateKey) {
+			writeResponse(w, hnap.Login, map[string]interface{}{"LoginResult": "FAILED"})
+			return
+		}
+
+		s.sessions[uid.Value] = privateKey
+		s.logins++
+		writeResponse(w, hnap.Login, map[string]interface{}{"LoginResult": hnap.OK})
+	default:
+		http.Error(w, fmt.Sprintf("unknown login action: %q", req.Action), http.StatusBadRequest)
+	}
+}
+
+// authorized reports whether the request was made with a login session and
+// carries its HNAP_AUTH.
+func (s *Server) authorized(r *http.Request, actionURI string) bool {
+	uid, err := r.Cookie("uid")
+	if err != nil {
+		return false
+	}
+	privateKey, ok := s.sessions[uid.Value]
+	if !ok {
+		return false
+	}
+	cookie, err := r.Cookie("PrivateKey")
+	if err != nil || cookie.Value != string(privateKey) {
+		return false
+	}
+	return s.validAuth(r, actionURI, privateKey)
+}
+
+// validAuth verifies the request's HNAP_AUTH, the digest of its timestamp and
+// action made with the private key.
+func (s *Server) validAuth(r *http.Request, actionURI string, privateKey []byte) bool {
+	fields := strings.Fields(r.Header.Get("HNAP_AUTH"))
+	if len(fields) != 2 {
+		return false
+	}
+	expected := digest(fmt.Sprintf(`%s"%s"`, fields[1], actionURI), privateKey)
+	return hmac.Equal([]byte(fields[0]), expected)
+}
+
+func writeResponse(w http.ResponseWriter, action string, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		action + "Response": response,
+	})
+}
+
+// digest is the HMAC-MD5 of the message as upper case hex.
+func digest(msg string, key []byte) []byte {
+	mac := hmac.New(md5.New, key)
+	mac.Write([]byte(msg))
+	return bytes.ToUpper([]byte(hex.EncodeToString(mac.Sum(nil))))
+}
+
+func randomString() string {
+	b := make([]byte, 10)
+	_, _ = rand.Read(b)
+	return strings.ToUpper(hex.EncodeToString(b))
+}
@@ -0,0 +1,144 @@
+package hnap
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jahkeup/prometheus-moto-exporter/pkg/plustable"
+)
+
+// logTimeLayout is the layout of the modem's event log timestamps once
+// whitespace is collapsed, ie: "18:26:54 Sun Nov 08 2020".
+const logTimeLayout = "15:04:05 Mon Jan 02 2006"
+
+// Event types classified from the log entry descriptions.
+const (
+	LogEventT3Timeout     = "t3_timeout"
+	LogEventT4Timeout     = "t4_timeout"
+	LogEventRangingFailed = "ranging_failure"
+	LogEventSyncLost      = "sync_loss"
+	LogEventOther         = "other"
+)
+
+// Timeout descriptions are written "T3 time-out", "T4 time out" and
+// "T3 timeouts" across firmware.
+var (
+	t3TimeoutPattern = regexp.MustCompile(`t3 time.?out`)
+	t4TimeoutPattern = regexp.MustCompile(`t4 time.?out`)
+)
+
+// LogEntry is a single row of the modem's event log.
+type LogEntry struct {
+	// Timestamp is the timestamp as reported by the modem.
+	Timestamp string
+	// Time is the parsed Timestamp, this is the zero time when the modem
+	// hasn't established its time (or the format is unknown).
+	Time time.Time
+	// Priority is the name of the priority, ie: "Critical".
+	Priority string
+	// Level is the numeric priority level, ie: 3 for "Critical (3)".
+	Level int64
+	// Description is the raw log message.
+	Description string
+}
+
+func (entry *LogEntry) Parse(row []string) error {
+	const (
+		timestampField = iota
+		priorityField
+		descriptionField
+
+		minRowSize
+	)
+
+	// Trailing separators leave an empty column behind.
+	if len(row) > minRowSize && strings.TrimSpace(row[len(row)-1]) == "" {
+		row = row[:len(row)-1]
+	}
+	if len(row) != minRowSize {
+		return errors.Errorf("invalid data size: expected %d but found %d", minRowSize, len(row))
+	}
+
+	entry.Timestamp = strings.Join(strings.Fields(row[timestampField]), " ")
+	entry.Time, _ = time.Parse(logTimeLayout, entry.Timestamp)
+
+	priority := strings.TrimSpace(row[priorityField])
+	entry.Priority = priority
+	if open := strings.LastIndex(priority, "("); open >= 0 && strings.HasSuffix(priority, ")") {
+		level, err := strconv.ParseInt(priority[open+1:len(priority)-1], 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "parse priority level")
+		}
+		entry.Level = level
+		entry.Priority = strings.TrimSpace(priority[:open])
+	}
+
+	entry.Description = strings.TrimSpace(row[descriptionField])
+
+	return nil
+}
+
+// Event classifies the entry by its description, returning one of the LogEvent
+// types.
+func (entry *LogEntry) Event() string {
+	desc := strings.ToLower(entry.Description)
+	switch {
+	case t3TimeoutPattern.MatchString(desc):
+		return LogEventT3Timeout
+	case t4TimeoutPattern.MatchString(desc):
+		return LogEventT4Timeout
+	case strings.Contains(desc, "retries exhausted"),
+		strings.Contains(desc, "ranging response"):
+		return LogEventRangingFailed
+	case strings.Contains(desc, "sync timing synchronization failure"),
+		strings.Contains(desc, "lost mdd timeout"),
+		strings.Contains(desc, "loss of sync"):
+		return LogEventSyncLost
+	default:
+		return LogEventOther
+	}
+}
+
+type MotoStatusLogResponse struct {
+	Entries []LogEntry
+
+	// ParseErrors are the rows that could not be parsed, these are left out
+	// of Entries.
+	ParseErrors []RowError
+}
+
+func (r *MotoStatusLogResponse) UnmarshalJSON(data []byte) error {
+	var innerType struct {
+		MotoStatusLogList string
+	}
+
+	err := json.Unmarshal(data, &innerType)
+	if err != nil {
+		return err
+	}
+
+	tbl := plustable.Parse(innerType.MotoStatusLogList)
+	entries := make([]LogEntry, 0, len(tbl))
+	var parseErrors []RowError
+	for _, row := range tbl {
+		var entry LogEntry
+		err = entry.Parse(row)
+		if err != nil {
+			logrus.WithError(err).WithField("row", row).Debug("could not parse data")
+			parseErrors = append(parseErrors, RowError{Table: TableLog, Row: row, Err: err})
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	r.Entries = entries
+	r.ParseErrors = parseErrors
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package hnap
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exampleLog = `{"MotoStatusLogList": "\n 18:26:54\n Sun Nov 08 2020^Critical (3)^No Ranging Response received - T3 time-out;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;^|+|Time Not Established^Notice (6)^Honoring MDD; IP provisioning mode = IPv6^", "GetMotoStatusLogResult": "OK"}`
+
+func TestMotoStatusLogResponse(t *testing.T) {
+	var resp MotoStatusLogResponse
+	require.NoError(t, json.Unmarshal([]byte(exampleLog), &resp))
+	require.Len(t, resp.Entries, 2)
+
+	first := resp.Entries[0]
+	assert.Equal(t, "18:26:54 Sun Nov 08 2020", first.Timestamp)
+	assert.Equal(t, time.Date(2020, time.November, 8, 18, 26, 54, 0, time.UTC), first.Time)
+	assert.Equal(t, "Critical", first.Priority)
+	assert.Equal(t, int64(3), first.Level)
+	assert.Equal(t, LogEventT3Timeout, first.Event())
+
+	second := resp.Entries[1]
+	assert.Equal(t, "Time Not Established", second.Timestamp)
+	assert.True(t, second.Time.IsZero())
+	assert.Equal(t, "Notice", second.Priority)
+	assert.Equal(t, int64(6), second.Level)
+	assert.Equal(t, LogEventOther, second.Event())
+}
+
+func TestLogEntryEvent(t *testing.T) {
+	testcases := map[string]string{
+		"No Ranging Response received - T3 time-out;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;":                                                                          LogEventT3Timeout,
+		"Started Unicast Maintenance Ranging - No Response received - T3 time-out;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;":                                            LogEventT3Timeout,
+		"16 consecutive T3 timeouts while trying to range on upstream channel 2;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;":                                              LogEventT3Timeout,
+		"Received Response to Broadcast Maintenance Request, But no Unicast Maintenance opportunities received - T4 time out;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;": LogEventT4Timeout,
+		"Unicast Maintenance Ranging attempted - No response - Retries exhausted;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;":                                             LogEventRangingFailed,
+		"Ranging Request Retries exhausted;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;":                                                                                   LogEventRangingFailed,
+		"SYNC Timing Synchronization failure - Failed to acquire QAM/QPSK symbol timing;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;":                                      LogEventSyncLost,
+		"Lost MDD Timeout;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:00;CM-QOS=1.1;CM-VER=3.1;":                                                                                                    LogEventSyncLost,
+		"Honoring MDD; IP provisioning mode = IPv6": LogEventOther,
+	}
+
+	for description, expected := range testcases {
+		t.Run(description, func(t *testing.T) {
+			entry := LogEntry{Description: description}
+			assert.Equal(t, expected, entry.Event())
+		})
+	}
+}
+
+func TestLogEntryParseInvalid(t *testing.T) {
+	var entry LogEntry
+	assert.Error(t, entry.Parse([]string{"only one column"}))
+	assert.Error(t, entry.Parse([]string{"ts", "Critical (x)", "desc"}))
+}
+
+func TestMotoStatusLogResponseBadRow(t *testing.T) {
+	var resp MotoStatusLogResponse
+	require.NoError(t, json.Unmarshal([]byte(`{"MotoStatusLogList": "Time Not Established^Notice (6)^Honoring MDD^|+|Time Not Established^Critical (x)^Unknown^|+|truncated"}`), &resp))
+	require.Len(t, resp.Entries, 1)
+	assert.Equal(t, "Honoring MDD", resp.Entries[0].Description)
+
+	require.Len(t, resp.ParseErrors, 2)
+	assert.Equal(t, TableLog, resp.ParseErrors[0].Table)
+	assert.Equal(t, "truncated", resp.ParseErrors[1].Row[0])
+}
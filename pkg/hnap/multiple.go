@@ -2,7 +2,7 @@ package hnap
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 )
 
 type getMultipleRequest struct {
@@ -31,7 +31,33 @@ func (g *GetMultipleHNAPsResponse) GetJSON(name string) (json.RawMessage, error)
 	// Might be namespaced under the request, check there too.
 	data, ok = g.HNAP[name+"Response"]
 	if !ok {
-		return nil, errors.New("no response found ")
+		return nil, fmt.Errorf("%s: %w", name, ErrMissingAction)
 	}
 	return data, nil
 }
+
+// Decode decodes the named action's response into v, once its result is
+// checked.
+func (g *GetMultipleHNAPsResponse) Decode(name string, v interface{}) error {
+	data, err := g.GetJSON(name)
+	if err != nil {
+		return err
+	}
+	err = checkResult(name, data)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return &DecodeError{Action: name, Err: err}
+	}
+	return nil
+}
+
+// Result gets the overall result of the GetMultipleHNAPs call, ie: "OK".
+func (g *GetMultipleHNAPsResponse) Result() string {
+	var result string
+	// Absent or malformed results are reported as empty.
+	_ = json.Unmarshal(g.HNAP[GetMultipleHNAPs+"Result"], &result)
+	return result
+}
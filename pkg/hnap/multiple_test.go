@@ -0,0 +1,43 @@
+package hnap
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMultipleHNAPsResponseDecode(t *testing.T) {
+	var response GetMultipleHNAPsResponse
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"GetMultipleHNAPsResponse": {
+			"GetMotoLagStatusResponse": {
+				"MotoLagCurrentStatus": "1",
+				"GetMotoLagStatusResult": "OK"
+			},
+			"GetMotoStatusLogResponse": {
+				"GetMotoStatusLogResult": "ERROR"
+			},
+			"GetHomeConnectionResponse": {
+				"GetHomeConnectionResult": "UN-AUTH"
+			},
+			"GetMultipleHNAPsResult": "OK"
+		}
+	}`), &response))
+
+	var lag MotoLagStatusResponse
+	require.NoError(t, response.Decode(GetMotoLagStatus, &lag))
+	assert.True(t, lag.Aggregated())
+
+	var failed *ErrActionFailed
+	err := response.Decode(GetMotoStatusLog, &MotoStatusLogResponse{})
+	require.ErrorAs(t, err, &failed)
+	assert.Equal(t, "ERROR", failed.Result)
+
+	err = response.Decode(GetHomeConnection, &HomeConnectionResponse{})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	err = response.Decode(GetMotoStatusSoftware, &MotoStatusSoftwareResponse{})
+	assert.ErrorIs(t, err, ErrMissingAction)
+}
@@ -0,0 +1,29 @@
+package hnap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table names, used to identify the plus-tables parsed from responses.
+const (
+	TableDownstream = "downstream"
+	TableUpstream   = "upstream"
+	TableLog        = "log"
+)
+
+// RowError is a row of a table that could not be parsed. Lenient parsing skips
+// these rows, recording the error in their place.
+type RowError struct {
+	Table string
+	Row   []string
+	Err   error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("%s row %q: %v", e.Table, strings.Join(e.Row, "^"), e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,22 @@
+package hnap
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exampleDownstreamBadRow = `{"MotoConnDownstreamChannel": "1^Locked^QAM256^33^663.0^-9.3^38.8^42325^10482^|+|33^Locked^OFDM PLC^159^722.0^-8.4^^-1773898168^1086340^"}`
+
+func TestDownstreamChannelResponseLenient(t *testing.T) {
+	var resp DownstreamChannelResponse
+	require.NoError(t, json.Unmarshal([]byte(exampleDownstreamBadRow), &resp))
+	require.Len(t, resp.Channels, 1)
+	assert.Equal(t, int64(1), resp.Channels[0].ID)
+
+	require.Len(t, resp.ParseErrors, 1)
+	assert.Equal(t, TableDownstream, resp.ParseErrors[0].Table)
+	assert.Equal(t, "33", resp.ParseErrors[0].Row[0])
+}
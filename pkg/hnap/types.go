@@ -1,9 +1,13 @@
 package hnap
 
 import (
+	"encoding/json"
 	"net"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -13,6 +17,10 @@ const (
 
 	OK        OKStatus        = "OK"
 	Connected ConnectedStatus = "Connected"
+
+	// Unauthorized is the result given for calls made without a valid login
+	// session.
+	Unauthorized OKStatus = "UN-AUTH"
 )
 
 type OKStatus = string
@@ -32,8 +40,8 @@ type MotoStatusStartupSequenceResponse struct {
 	ConnectivityStatus  OKStatus `json:"MotoConnConnectivityStatus"`
 	ConnectivityComment string   `json:"MotoConnConnectivityComment"`
 
-	BootStatus  OKStatus `json:"MotoBootStatus"`
-	BootComment string   `json:"MotoBootComment"`
+	BootStatus  OKStatus `json:"MotoConnBootStatus"`
+	BootComment string   `json:"MotoConnBootComment"`
 
 	ConfigurationFileStatus OKStatus `json:"MotoConnConfigurationFileStatus"`
 	ConfigurationFileName   string   `json:"MotoConnConfigurationFileComment"`
@@ -57,6 +65,46 @@ func (m *MotoStatusStartupSequenceResponse) DownstreamFrequencyHZ() float64 {
 	return freq
 }
 
+// Startup sequence step names.
+const (
+	StartupStepDownstream        = "downstream"
+	StartupStepConnectivity      = "connectivity"
+	StartupStepBoot              = "boot"
+	StartupStepConfigurationFile = "configuration_file"
+	StartupStepSecurity          = "security"
+)
+
+// StartupStep is a single step of the device's startup sequence.
+type StartupStep struct {
+	Name    string
+	Status  string
+	Comment string
+}
+
+// OK reports whether the step completed successfully.
+func (s *StartupStep) OK() bool {
+	switch s.Status {
+	case OK, Enabled, Locked:
+		return true
+	default:
+		return false
+	}
+}
+
+// Steps lists the steps of the startup sequence in the order the device
+// performs them.
+func (m *MotoStatusStartupSequenceResponse) Steps() []StartupStep {
+	return []StartupStep{
+		// The downstream step doesn't carry a status of its own, its comment
+		// is the lock status.
+		{Name: StartupStepDownstream, Status: m.DownstreamComment, Comment: m.DownstreamComment},
+		{Name: StartupStepConnectivity, Status: m.ConnectivityStatus, Comment: m.ConnectivityComment},
+		{Name: StartupStepBoot, Status: m.BootStatus, Comment: m.BootComment},
+		{Name: StartupStepConfigurationFile, Status: m.ConfigurationFileStatus, Comment: m.ConfigurationFileName},
+		{Name: StartupStepSecurity, Status: m.SecurityStatus, Comment: m.SecurityComment},
+	}
+}
+
 type HomeAddressResponse struct {
 	// NOTE: hwaddr isn't parsed here.
 	HWAddr  string `json:"MotoHomeMacAddress"`
@@ -75,7 +123,81 @@ type MotoStatusSoftwareResponse struct {
 	CustomerVersion string `json:"StatusSoftwareCustomerVer"`
 }
 
+type MotoLagStatusResponse struct {
+	// CurrentStatus is the link aggregation status, 0 when the device is not
+	// aggregating its ethernet ports.
+	CurrentStatus int64
+}
+
+func (m *MotoLagStatusResponse) UnmarshalJSON(data []byte) error {
+	var innerType struct {
+		MotoLagCurrentStatus json.RawMessage
+	}
+
+	err := json.Unmarshal(data, &innerType)
+	if err != nil {
+		return err
+	}
+
+	// Models that don't support LAG leave the status empty, or report one
+	// that isn't numeric, these aren't aggregating.
+	status := strings.Trim(string(innerType.MotoLagCurrentStatus), `" `)
+	m.CurrentStatus, _ = strconv.ParseInt(status, 10, 64)
+
+	return nil
+}
+
+// Aggregated reports whether link aggregation is currently active.
+func (m *MotoLagStatusResponse) Aggregated() bool {
+	return m.CurrentStatus != 0
+}
+
 type MotoStatusConnectionInfoResponse struct {
 	Uptime        string `json:"MotoConnSystemUpTime"`
 	NetworkAccess string `json:"MotoConnNetworkAccess"`
 }
+
+// UptimeDuration parses the device reported uptime.
+func (m *MotoStatusConnectionInfoResponse) UptimeDuration() (time.Duration, error) {
+	return ParseUptime(m.Uptime)
+}
+
+// NetworkAccessAllowed reports whether the device is allowed network access by
+// the provider.
+func (m *MotoStatusConnectionInfoResponse) NetworkAccessAllowed() bool {
+	return m.NetworkAccess == Allowed
+}
+
+// ParseUptime parses the device's uptime format into a duration, ie: "4 days
+// 08h:57m:40s".
+func ParseUptime(uptime string) (time.Duration, error) {
+	fs := strings.Fields(uptime)
+	if len(fs) == 0 {
+		return 0, errors.New("empty uptime")
+	}
+
+	var total time.Duration
+
+	// Leading "N days", or "N day", count.
+	if len(fs) == 3 && strings.HasPrefix(fs[1], "day") {
+		days, err := strconv.ParseInt(fs[0], 10, 64)
+		if err != nil {
+			return 0, errors.Wrap(err, "parse uptime days")
+		}
+		total += time.Duration(days) * 24 * time.Hour
+		fs = fs[2:]
+	}
+	if len(fs) != 1 {
+		return 0, errors.Errorf("unknown uptime format: %q", uptime)
+	}
+
+	// Remaining "08h:57m:40s" is close enough to a Go duration once the
+	// separators are dropped.
+	clock, err := time.ParseDuration(strings.ReplaceAll(fs[0], ":", ""))
+	if err != nil {
+		return 0, errors.Wrap(err, "parse uptime clock")
+	}
+	total += clock
+
+	return total, nil
+}
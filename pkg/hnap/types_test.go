@@ -0,0 +1,106 @@
+package hnap
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUptime(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{input: "4 days 08h:57m:40s",
+			expected: 4*24*time.Hour + 8*time.Hour + 57*time.Minute + 40*time.Second},
+		{input: "1 day 00h:00m:01s",
+			expected: 24*time.Hour + time.Second},
+		{input: "00h:12m:00s",
+			expected: 12 * time.Minute},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.input, func(t *testing.T) {
+			actual, err := ParseUptime(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	for _, invalid := range []string{"", "4 days", "x days 00h:00m:00s", "sometime"} {
+		t.Run(invalid, func(t *testing.T) {
+			_, err := ParseUptime(invalid)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMotoLagStatusResponse(t *testing.T) {
+	testcases := map[string]bool{
+		`{"MotoLagCurrentStatus": "1"}`:    true,
+		`{"MotoLagCurrentStatus": 1}`:      true,
+		`{"MotoLagCurrentStatus": "0"}`:    false,
+		`{"MotoLagCurrentStatus": ""}`:     false,
+		`{"MotoLagCurrentStatus": "N/A"}`:  false,
+		`{"GetMotoLagStatusResult": "OK"}`: false,
+		`{"MotoLagCurrentStatus": null}`:   false,
+	}
+
+	for input, expected := range testcases {
+		t.Run(input, func(t *testing.T) {
+			var resp MotoLagStatusResponse
+			require.NoError(t, json.Unmarshal([]byte(input), &resp))
+			assert.Equal(t, expected, resp.Aggregated())
+		})
+	}
+}
+
+func TestMotoStatusStartupSequenceResponseSteps(t *testing.T) {
+	resp := MotoStatusStartupSequenceResponse{
+		DownstreamComment:       "Locked",
+		ConnectivityStatus:      "OK",
+		ConnectivityComment:     "Operational",
+		BootStatus:              "In Progress",
+		BootComment:             "Registration",
+		ConfigurationFileStatus: "OK",
+		ConfigurationFileName:   "d11_m_mb8600_gigabit_c01.cm",
+		SecurityStatus:          "Disabled",
+		SecurityComment:         "Disabled",
+	}
+
+	steps := resp.Steps()
+	names := make([]string, 0, len(steps))
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	assert.Equal(t, []string{StartupStepDownstream, StartupStepConnectivity, StartupStepBoot, StartupStepConfigurationFile, StartupStepSecurity}, names)
+
+	// The downstream step's status is its comment.
+	assert.Equal(t, StartupStep{Name: StartupStepDownstream, Status: "Locked", Comment: "Locked"}, steps[0])
+	assert.True(t, steps[0].OK())
+	assert.True(t, steps[1].OK())
+	assert.False(t, steps[2].OK())
+	assert.Equal(t, "d11_m_mb8600_gigabit_c01.cm", steps[3].Comment)
+	assert.False(t, steps[4].OK())
+
+	resp.DownstreamComment = "Not Locked"
+	downstream := resp.Steps()[0]
+	assert.False(t, downstream.OK())
+}
+
+func TestStartupStepOK(t *testing.T) {
+	for status, expected := range map[string]bool{
+		OK:            true,
+		Enabled:       true,
+		Locked:        true,
+		"Not Locked":  false,
+		"In Progress": false,
+		"":            false,
+	} {
+		step := StartupStep{Status: status}
+		assert.Equal(t, expected, step.OK(), status)
+	}
+}
@@ -75,6 +75,10 @@ func (info *UpstreamInfo) Parse(row []string) error {
 
 type UpstreamChannelResponse struct {
 	Channels []UpstreamInfo
+
+	// ParseErrors are the rows that could not be parsed, these are left out
+	// of Channels.
+	ParseErrors []RowError
 }
 
 func (r *UpstreamChannelResponse) UnmarshalJSON(data []byte) error {
@@ -88,16 +92,21 @@ func (r *UpstreamChannelResponse) UnmarshalJSON(data []byte) error {
 	}
 
 	tbl := plustable.Parse(innerType.MotoConnUpstreamChannel)
-	info := make([]UpstreamInfo, len(tbl))
-	for i, row := range tbl {
-		err = info[i].Parse(row)
+	info := make([]UpstreamInfo, 0, len(tbl))
+	var parseErrors []RowError
+	for _, row := range tbl {
+		var channel UpstreamInfo
+		err = channel.Parse(row)
 		if err != nil {
-			logrus.WithError(err).WithField("row", row).Error("could not parse data")
-			return err
+			logrus.WithError(err).WithField("row", row).Debug("could not parse data")
+			parseErrors = append(parseErrors, RowError{Table: TableUpstream, Row: row, Err: err})
+			continue
 		}
+		info = append(info, channel)
 	}
 
 	r.Channels = info
+	r.ParseErrors = parseErrors
 
 	return nil
 }